@@ -0,0 +1,402 @@
+// Package alert evaluates price alert rules against polled tickers and sends
+// notifications to pluggable sinks.
+//
+// Rules and sinks are usually loaded from a JSON file:
+//
+//     {
+//         "sinks": {
+//             "log":  {"type": "stdout"},
+//             "ops":  {"type": "webhook", "url": "http://localhost:9000/alerts"},
+//             "page": {"type": "command", "command": ["/usr/local/bin/page", "btc"]}
+//         },
+//         "rules": [
+//             {"name": "usd-high", "kind": "threshold", "symbol": "USD",
+//              "direction": "above", "level": 400, "hysteresis": 5,
+//              "cooldown": "30m", "sinks": ["log", "ops"]},
+//             {"name": "usd-move", "kind": "move", "symbol": "USD",
+//              "percent": 5, "window": "1h"},
+//             {"name": "eur-spread", "kind": "spread", "symbol": "EUR",
+//              "market": true, "percent": 1.5}
+//         ]
+//     }
+package alert
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+type Kind string
+
+const (
+    // Threshold fires when Last crosses Level in Direction.
+    Threshold       Kind = "threshold"
+    // Move fires when Last moves by Percent or more, either way, within
+    // Window.
+    Move            Kind = "move"
+    // Spread fires when the bid/ask spread reaches Level (in price) or
+    // Percent (of the mid price).
+    Spread          Kind = "spread"
+)
+
+type Direction string
+
+const (
+    Above           Direction = "above"
+    Below           Direction = "below"
+)
+
+// Duration is a time.Duration that reads and writes as a string such as
+// "90s" or "1h30m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+    return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+    var s string
+    if err := json.Unmarshal(data, &s); err != nil { return err }
+    v, err := time.ParseDuration(s)
+    if err != nil { return err }
+    *d = Duration(v)
+    return nil
+}
+
+// Rule is a single alert definition.
+type Rule struct {
+    Name            string          `json:"name"`
+    Kind            Kind            `json:"kind"`
+    Symbol          string          `json:"symbol"`
+    // Market selects the market ticker instead of the global one.
+    Market          bool            `json:"market"`
+    Direction       Direction       `json:"direction,omitempty"`
+    Level           bapi.Decimal    `json:"level"`
+    Percent         bapi.Decimal    `json:"percent"`
+    Window          Duration        `json:"window,omitempty"`
+    // Hysteresis is how far back past the trigger point the watched value
+    // has to go before the rule can fire again, in the rule's own unit:
+    // price for thresholds and absolute spreads, percentage points for
+    // moves and relative spreads.
+    Hysteresis      bapi.Decimal    `json:"hysteresis"`
+    // Cooldown is the minimum time between two alerts from the rule.
+    Cooldown        Duration        `json:"cooldown,omitempty"`
+    // Sinks names the sinks to notify. If empty, all of them are.
+    Sinks           []string        `json:"sinks,omitempty"`
+}
+
+func (r *Rule) validate() error {
+    if r.Name == "" { return errors.New("rule without a name.") }
+    if r.Symbol == "" { return fmt.Errorf("rule %v: no symbol.", r.Name) }
+    if r.Hysteresis.Sign() < 0 || r.Cooldown < 0 {
+        return fmt.Errorf("rule %v: negative hysteresis or cooldown.", r.Name)
+    }
+
+    switch r.Kind {
+    case Threshold:
+        if r.Direction != Above && r.Direction != Below {
+            return fmt.Errorf("rule %v: direction must be %q or %q.", r.Name, Above, Below)
+        }
+    case Move:
+        if r.Percent.Sign() <= 0 || r.Window <= 0 {
+            return fmt.Errorf("rule %v: move rules need a positive percent and window.", r.Name)
+        }
+    case Spread:
+        if (r.Level.Sign() > 0) == (r.Percent.Sign() > 0) {
+            return fmt.Errorf("rule %v: spread rules need either a level or a percent.", r.Name)
+        }
+    default:
+        return fmt.Errorf("rule %v: unknown kind %q.", r.Name, r.Kind)
+    }
+    return nil
+}
+
+// Alert is what a rule firing sends to its sinks.
+type Alert struct {
+    Rule            string          `json:"rule"`
+    Kind            Kind            `json:"kind"`
+    Symbol          string          `json:"symbol"`
+    Market          bool            `json:"market"`
+    // Value is what the rule measured: the price, the percent move or the
+    // spread.
+    Value           bapi.Decimal    `json:"value"`
+    Last            bapi.Decimal    `json:"last"`
+    Time            time.Time       `json:"time"`
+    Message         string          `json:"message"`
+}
+
+// Config is the layout of a rules file.
+type Config struct {
+    Sinks           map[string]SinkConfig   `json:"sinks"`
+    Rules           []Rule                  `json:"rules"`
+}
+
+// LoadFile reads a rules file and builds the Engine it describes.
+func LoadFile(name string) (*Engine, error) {
+    f, err := os.Open(name)
+    if err != nil { return nil, err }
+    defer f.Close()
+
+    e, err := Load(f)
+    if err != nil { return nil, fmt.Errorf("%v: %v", name, err) }
+    return e, nil
+}
+
+// Load reads a rules file from r and builds the Engine it describes.
+func Load(r io.Reader) (*Engine, error) {
+    var cfg Config
+    dec := json.NewDecoder(r)
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(&cfg); err != nil { return nil, err }
+
+    sinks := make(map[string]Sink, len(cfg.Sinks))
+    for name, sc := range cfg.Sinks {
+        s, err := sc.Sink()
+        if err != nil { return nil, fmt.Errorf("sink %v: %v", name, err) }
+        sinks[name] = s
+    }
+    return NewEngine(cfg.Rules, sinks)
+}
+
+// Engine keeps the state of a set of rules and notifies their sinks when
+// they fire. Rules are evaluated on ticker timestamps rather than the wall
+// clock, so windows and cooldowns follow upstream's notion of time.
+type Engine struct {
+    // OnError, if set, is called by Run with errors from the client and
+    // the sinks.
+    OnError         func(error)
+
+    rules           []*ruleState
+    sinks           map[string]Sink
+}
+
+type sample struct {
+    time            time.Time
+    last            bapi.Decimal
+}
+
+type ruleState struct {
+    Rule
+
+    // armed is false after firing, until the value clears the hysteresis
+    // band. seen tells whether armed has been set up yet.
+    armed           bool
+    seen            bool
+    fired           time.Time
+    // samples holds the recent prices for move rules, oldest first.
+    samples         []sample
+}
+
+// NewEngine checks rules and returns an Engine for them. Every sink a rule
+// refers to must be in sinks.
+func NewEngine(rules []Rule, sinks map[string]Sink) (*Engine, error) {
+    e := &Engine{sinks: sinks}
+    names := make(map[string]bool)
+    for _, r := range rules {
+        if err := r.validate(); err != nil { return nil, err }
+        if names[r.Name] { return nil, fmt.Errorf("duplicate rule %v.", r.Name) }
+        names[r.Name] = true
+        for _, s := range r.Sinks {
+            if _, ok := sinks[s]; !ok { return nil, fmt.Errorf("rule %v: unknown sink %v.", r.Name, s) }
+        }
+        e.rules = append(e.rules, &ruleState{Rule: r})
+    }
+    return e, nil
+}
+
+// Rules returns the rules of the engine.
+func (e *Engine) Rules() []Rule {
+    rules := make([]Rule, len(e.rules))
+    for i, r := range e.rules { rules[i] = r.Rule }
+    return rules
+}
+
+// Evaluate runs the rules for symbol against t and notifies the sinks of
+// every rule that fires. It returns the alerts sent, along with the first
+// error from a sink. Evaluate is not safe for concurrent use.
+func (e *Engine) Evaluate(ctx context.Context, symbol string, market bool, t bapi.Ticker) ([]Alert, error) {
+    var alerts []Alert
+    var firstErr error
+    for _, r := range e.rules {
+        if r.Symbol != symbol || r.Market != market { continue }
+        a, ok := r.evaluate(t)
+        if !ok { continue }
+        alerts = append(alerts, a)
+        if err := e.notify(ctx, r.Sinks, a); err != nil && firstErr == nil { firstErr = err }
+    }
+    return alerts, firstErr
+}
+
+func (e *Engine) notify(ctx context.Context, names []string, a Alert) error {
+    var firstErr error
+    send := func(name string, s Sink) {
+        if err := s.Notify(ctx, a); err != nil && firstErr == nil {
+            firstErr = fmt.Errorf("sink %v: %v", name, err)
+        }
+    }
+    if len(names) == 0 {
+        for name, s := range e.sinks { send(name, s) }
+    } else {
+        for _, name := range names { send(name, e.sinks[name]) }
+    }
+    return firstErr
+}
+
+// Run polls the tickers the rules refer to through c, using a bapi.Watcher
+// per ticker family, and evaluates every update until ctx is done.
+func (e *Engine) Run(ctx context.Context, c bapi.Client) error {
+    return e.RunWith(ctx, func(market bool, symbols []string) *bapi.Watcher {
+        w := bapi.NewWatcher(c, symbols...)
+        w.Market = market
+        return w
+    })
+}
+
+// RunWith is like Run, but lets the caller set up the watchers, e.g. to
+// change their schedule. newWatcher is called once for the global tickers
+// and once for the market tickers, if any rule needs them.
+func (e *Engine) RunWith(ctx context.Context, newWatcher func(market bool, symbols []string) *bapi.Watcher) error {
+    type update struct {
+        bapi.TickerUpdate
+        market bool
+    }
+    updates := make(chan update)
+    running := 0
+    for _, market := range []bool{false, true} {
+        symbols := e.symbols(market)
+        if len(symbols) == 0 { continue }
+        w := newWatcher(market, symbols)
+        if w.OnError == nil { w.OnError = e.OnError }
+        ch := w.Watch(ctx)
+        running++
+        go func(market bool) {
+            for u := range ch { updates <- update{u, market} }
+            updates <- update{market: market}
+        }(market)
+    }
+
+    for running > 0 {
+        u := <-updates
+        if u.Symbol == "" {
+            running--
+            continue
+        }
+        _, err := e.Evaluate(ctx, u.Symbol, u.market, u.Ticker)
+        if err != nil && e.OnError != nil { e.OnError(err) }
+    }
+    return ctx.Err()
+}
+
+func (e *Engine) symbols(market bool) []string {
+    var symbols []string
+    seen := make(map[string]bool)
+    for _, r := range e.rules {
+        if r.Market != market || seen[r.Symbol] { continue }
+        seen[r.Symbol] = true
+        symbols = append(symbols, r.Symbol)
+    }
+    return symbols
+}
+
+func (r *ruleState) evaluate(t bapi.Ticker) (Alert, bool) {
+    value, ok := r.measure(t)
+    if !ok { return Alert{}, false }
+
+    triggered, cleared := r.compare(value)
+    if !r.seen {
+        // Only crossings count, so a rule that starts out triggered waits
+        // for the value to clear first.
+        r.seen = true
+        r.armed = !triggered
+        return Alert{}, false
+    }
+    if !r.armed {
+        if cleared { r.armed = true }
+        return Alert{}, false
+    }
+    if !triggered { return Alert{}, false }
+    if !r.fired.IsZero() && t.Timestamp.Sub(r.fired) < time.Duration(r.Cooldown) {
+        return Alert{}, false
+    }
+
+    r.armed = false
+    r.fired = t.Timestamp
+    return Alert{
+        Rule:    r.Name,
+        Kind:    r.Kind,
+        Symbol:  r.Symbol,
+        Market:  r.Market,
+        Value:   value,
+        Last:    t.Last,
+        Time:    t.Timestamp,
+        Message: r.message(value),
+    }, true
+}
+
+// measure works out the value the rule watches.
+func (r *ruleState) measure(t bapi.Ticker) (bapi.Decimal, bool) {
+    switch r.Kind {
+    case Threshold:
+        return t.Last, !t.Last.IsZero()
+
+    case Move:
+        if t.Last.IsZero() { return bapi.Decimal{}, false }
+        start := t.Timestamp.Add(-time.Duration(r.Window))
+        i := 0
+        for i < len(r.samples) && r.samples[i].time.Before(start) { i++ }
+        r.samples = append(r.samples[i:], sample{t.Timestamp, t.Last})
+        ref := r.samples[0].last
+        return t.Last.Sub(ref).PercentOf(ref), true
+
+    case Spread:
+        if t.Bid.Sign() <= 0 || t.Ask.Sign() <= 0 { return bapi.Decimal{}, false }
+        spread := t.Ask.Sub(t.Bid)
+        if r.Level.Sign() > 0 { return spread, true }
+        // As a percentage of the midpoint, (Ask + Bid) / 2.
+        return spread.Mul(bapi.NewDecimal(2, 0)).PercentOf(t.Ask.Add(t.Bid)), true
+    }
+    return bapi.Decimal{}, false
+}
+
+// compare tells whether value triggers the rule, and whether it is far
+// enough from the trigger point to re-arm it.
+func (r *ruleState) compare(value bapi.Decimal) (triggered, cleared bool) {
+    switch r.Kind {
+    case Threshold:
+        if r.Direction == Above {
+            return value.Cmp(r.Level) >= 0, value.Cmp(r.Level.Sub(r.Hysteresis)) < 0
+        }
+        return value.Cmp(r.Level) <= 0, value.Cmp(r.Level.Add(r.Hysteresis)) > 0
+    case Move:
+        v := value.Abs()
+        return v.Cmp(r.Percent) >= 0, v.Cmp(r.Percent.Sub(r.Hysteresis)) < 0
+    default:
+        limit := r.Percent
+        if r.Level.Sign() > 0 { limit = r.Level }
+        return value.Cmp(limit) >= 0, value.Cmp(limit.Sub(r.Hysteresis)) < 0
+    }
+}
+
+func (r *ruleState) message(value bapi.Decimal) string {
+    family := "global"
+    if r.Market { family = "market" }
+
+    switch r.Kind {
+    case Threshold:
+        return fmt.Sprintf("%v %v last %v crossed %v %v.", r.Symbol, family, value, r.Direction, r.Level)
+    case Move:
+        return fmt.Sprintf("%v %v last moved %v%% within %v.", r.Symbol, family, value, time.Duration(r.Window))
+    default:
+        if r.Level.Sign() > 0 {
+            return fmt.Sprintf("%v %v spread %v reached %v.", r.Symbol, family, value, r.Level)
+        }
+        return fmt.Sprintf("%v %v spread %v%% reached %v%%.", r.Symbol, family, value, r.Percent)
+    }
+}
@@ -0,0 +1,212 @@
+package alert
+
+import (
+    "context"
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+type collector struct {
+    mu              sync.Mutex
+    alerts          []Alert
+}
+
+func (c *collector) Notify(ctx context.Context, a Alert) error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.alerts = append(c.alerts, a)
+    return nil
+}
+
+func (c *collector) rules() []string {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    var names []string
+    for _, a := range c.alerts { names = append(names, a.Rule) }
+    return names
+}
+
+var t0 = time.Date(2014, 11, 4, 14, 0, 0, 0, time.UTC)
+
+func tick(min int, last string) bapi.Ticker {
+    return bapi.Ticker{Last: bapi.MustParseDecimal(last), Timestamp: t0.Add(time.Duration(min) * time.Minute)}
+}
+
+func TestLoad(t *testing.T) {
+    cfg := `{
+        "sinks": {"log": {"type": "stdout"}, "hook": {"type": "webhook", "url": "http://localhost:9000/"}},
+        "rules": [
+            {"name": "high", "kind": "threshold", "symbol": "USD", "direction": "above", "level": 400, "cooldown": "30m", "sinks": ["hook"]},
+            {"name": "move", "kind": "move", "symbol": "USD", "percent": "2.5", "window": "1h"},
+            {"name": "spread", "kind": "spread", "symbol": "EUR", "market": true, "level": 3}
+        ]
+    }`
+    e, err := Load(strings.NewReader(cfg))
+    if err != nil { t.Fatal(err) }
+    rules := e.Rules()
+    if len(rules) != 3 || rules[0].Cooldown != Duration(30 * time.Minute) || !rules[1].Percent.Equal(bapi.MustParseDecimal("2.5")) {
+        t.Errorf("got %+v", rules)
+    }
+
+    for _, bad := range []string{
+        `{"rules": [{"name": "x", "kind": "threshold", "symbol": "USD", "level": 1}]}`,
+        `{"rules": [{"name": "x", "kind": "move", "symbol": "USD", "percent": 1}]}`,
+        `{"rules": [{"name": "x", "kind": "spread", "symbol": "USD", "level": 1, "percent": 1}]}`,
+        `{"rules": [{"name": "x", "kind": "nope", "symbol": "USD"}]}`,
+        `{"rules": [{"name": "x", "kind": "spread", "symbol": "USD", "level": 1, "sinks": ["nope"]}]}`,
+        `{"sinks": {"x": {"type": "webhook"}}}`,
+        `{"rulez": []}`,
+    } {
+        if _, err := Load(strings.NewReader(bad)); err == nil {
+            t.Errorf("%v: no error", bad)
+        }
+    }
+}
+
+func TestThreshold(t *testing.T) {
+    c := &collector{}
+    e, err := NewEngine([]Rule{{
+        Name: "high", Kind: Threshold, Symbol: "USD", Direction: Above,
+        Level: bapi.MustParseDecimal("400"), Hysteresis: bapi.MustParseDecimal("5"),
+        Cooldown: Duration(10 * time.Minute),
+    }}, map[string]Sink{"c": c})
+    if err != nil { t.Fatal(err) }
+
+    fired := 0
+    for i, last := range []string{
+        "405",  // starts triggered: needs to clear first
+        "398",  // within the hysteresis band, not cleared
+        "394",  // cleared
+        "401",  // fires
+        "394",  // cleared
+        "402",  // in cooldown
+        "403",
+        "394",
+        "410",  // fires, 12 minutes after the first
+    } {
+        alerts, err := e.Evaluate(context.Background(), "USD", false, tick(i * 2, last))
+        if err != nil { t.Fatal(err) }
+        fired += len(alerts)
+        // Other families and symbols are left alone.
+        if alerts, _ := e.Evaluate(context.Background(), "USD", true, tick(i * 2, last)); len(alerts) > 0 {
+            t.Errorf("market ticker fired %+v", alerts)
+        }
+    }
+    if fired != 2 || len(c.alerts) != 2 {
+        t.Fatalf("got %v alerts, want 2", fired)
+    }
+    if a := c.alerts[0]; !a.Value.Equal(bapi.MustParseDecimal("401")) || !a.Time.Equal(t0.Add(6 * time.Minute)) {
+        t.Errorf("got %+v", a)
+    }
+}
+
+func TestMoveAndSpread(t *testing.T) {
+    c := &collector{}
+    e, err := NewEngine([]Rule{
+        {Name: "move", Kind: Move, Symbol: "USD", Percent: bapi.MustParseDecimal("5"), Window: Duration(10 * time.Minute)},
+        {Name: "spread", Kind: Spread, Symbol: "USD", Percent: bapi.MustParseDecimal("1")},
+    }, map[string]Sink{"c": c})
+    if err != nil { t.Fatal(err) }
+
+    ctx := context.Background()
+    e.Evaluate(ctx, "USD", false, tick(0, "100"))
+    // A slow drift never adds up to 5% within the window.
+    for i, last := range []string{"102", "104", "106", "108"} {
+        if alerts, _ := e.Evaluate(ctx, "USD", false, tick(6 * (i + 1), last)); len(alerts) > 0 {
+            t.Fatalf("got %+v", alerts)
+        }
+    }
+    alerts, _ := e.Evaluate(ctx, "USD", false, tick(26, "100"))
+    if len(alerts) != 1 || !alerts[0].Value.Equal(bapi.MustParseDecimal("-5.6604")) {
+        t.Fatalf("got %+v", alerts)
+    }
+
+    tk := tick(27, "101")
+    tk.Bid, tk.Ask = bapi.MustParseDecimal("100.5"), bapi.MustParseDecimal("101.5")
+    e.Evaluate(ctx, "USD", false, tk)
+    tk.Bid, tk.Ask = bapi.MustParseDecimal("100"), bapi.MustParseDecimal("102")
+    alerts, _ = e.Evaluate(ctx, "USD", false, tk)
+    if len(alerts) != 1 || alerts[0].Rule != "spread" || !alerts[0].Value.Equal(bapi.MustParseDecimal("1.9802")) {
+        t.Fatalf("got %+v", alerts)
+    }
+}
+
+func TestSinks(t *testing.T) {
+    a := Alert{Rule: "high", Symbol: "USD", Value: bapi.MustParseDecimal("401"), Message: "USD up."}
+
+    var got Alert
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        json.NewDecoder(r.Body).Decode(&got)
+        if r.URL.Path == "/fail" { http.Error(w, "no", http.StatusInternalServerError) }
+    }))
+    defer srv.Close()
+
+    if err := (&WebhookSink{URL: srv.URL}).Notify(context.Background(), a); err != nil { t.Fatal(err) }
+    if got.Rule != "high" || !got.Value.Equal(a.Value) {
+        t.Errorf("webhook got %+v", got)
+    }
+    if err := (&WebhookSink{URL: srv.URL + "/fail"}).Notify(context.Background(), a); err == nil {
+        t.Error("webhook failure not reported")
+    }
+
+    var buf strings.Builder
+    NewWriterSink(&buf).Notify(context.Background(), a)
+    if !strings.Contains(buf.String(), "[high] USD up.") {
+        t.Errorf("writer got %q", buf.String())
+    }
+
+    if _, err := exec.LookPath("sh"); err != nil { t.Skip("no sh") }
+    out := filepath.Join(t.TempDir(), "out")
+    cmd := &CommandSink{Command: []string{"sh", "-c", `echo "$ALERT_RULE $ALERT_VALUE" > "$0"`, out}}
+    if err := cmd.Notify(context.Background(), a); err != nil { t.Fatal(err) }
+    data, _ := ioutil.ReadFile(out)
+    if string(data) != "high 401\n" {
+        t.Errorf("command got %q", data)
+    }
+}
+
+func TestRun(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    c := &collector{}
+    e, err := NewEngine([]Rule{{
+        Name: "high", Kind: Threshold, Symbol: "USD", Direction: Above, Level: bapi.MustParseDecimal("400"),
+    }}, map[string]Sink{"c": c})
+    if err != nil { t.Fatal(err) }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan error)
+    go func() {
+        done <- e.RunWith(ctx, func(market bool, symbols []string) *bapi.Watcher {
+            w := bapi.NewWatcher(srv.APIClient(), symbols...)
+            w.Market = market
+            w.Recheck = 5 * time.Millisecond
+            return w
+        })
+    }()
+
+    time.Sleep(20 * time.Millisecond)
+    srv.SetFixture("ticker/global/USD", []byte(`{"last": 410, "timestamp": "Tue, 04 Nov 2014 14:23:03 -0000"}`))
+    deadline := time.Now().Add(time.Second)
+    for len(c.rules()) == 0 && time.Now().Before(deadline) { time.Sleep(5 * time.Millisecond) }
+
+    cancel()
+    if err := <-done; err != context.Canceled {
+        t.Errorf("Run returned %v", err)
+    }
+    if got := c.rules(); len(got) != 1 {
+        t.Errorf("got alerts %v", got)
+    }
+}
@@ -0,0 +1,121 @@
+package alert
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "os/exec"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Sink is something alerts can be sent to.
+type Sink interface {
+    Notify(ctx context.Context, a Alert) error
+}
+
+// SinkConfig describes a sink in a rules file. Type is one of "stdout",
+// "webhook" (which needs URL) or "command" (which needs Command).
+type SinkConfig struct {
+    Type            string          `json:"type"`
+    URL             string          `json:"url,omitempty"`
+    Command         []string        `json:"command,omitempty"`
+}
+
+// Sink builds the sink described by sc.
+func (sc SinkConfig) Sink() (Sink, error) {
+    switch sc.Type {
+    case "stdout":
+        return NewWriterSink(os.Stdout), nil
+    case "webhook":
+        if sc.URL == "" { return nil, errors.New("webhook without a url.") }
+        return &WebhookSink{URL: sc.URL}, nil
+    case "command":
+        if len(sc.Command) == 0 { return nil, errors.New("command hook without a command.") }
+        return &CommandSink{Command: sc.Command}, nil
+    }
+    return nil, fmt.Errorf("unknown sink type %q.", sc.Type)
+}
+
+// WriterSink writes one line per alert to an io.Writer.
+type WriterSink struct {
+    mu              sync.Mutex
+    w               io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+    return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Notify(ctx context.Context, a Alert) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    _, err := fmt.Fprintf(s.w, "%v [%v] %v\n", a.Time.Format(time.RFC3339), a.Rule, a.Message)
+    return err
+}
+
+// WebhookSink POSTs every alert as JSON to URL. Any status other than 2xx
+// is an error.
+type WebhookSink struct {
+    URL             string
+    // Client defaults to http.DefaultClient.
+    Client          *http.Client
+}
+
+func (s *WebhookSink) Notify(ctx context.Context, a Alert) error {
+    body, err := json.Marshal(a)
+    if err != nil { return err }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+    if err != nil { return err }
+    req.Header.Set("Content-Type", "application/json")
+
+    client := s.Client
+    if client == nil { client = http.DefaultClient }
+    resp, err := client.Do(req)
+    if err != nil { return err }
+    defer resp.Body.Close()
+    io.Copy(ioutil.Discard, resp.Body)
+
+    if resp.StatusCode/100 != 2 {
+        return fmt.Errorf("webhook returned %v.", resp.Status)
+    }
+    return nil
+}
+
+// CommandSink runs a command for every alert. The alert is written to its
+// standard input as JSON, and the most useful fields are also passed in
+// the ALERT_RULE, ALERT_SYMBOL, ALERT_VALUE and ALERT_MESSAGE environment
+// variables.
+type CommandSink struct {
+    Command         []string
+}
+
+func (s *CommandSink) Notify(ctx context.Context, a Alert) error {
+    body, err := json.Marshal(a)
+    if err != nil { return err }
+
+    cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+    cmd.Stdin = bytes.NewReader(body)
+    cmd.Env = append(os.Environ(),
+        "ALERT_RULE=" + a.Rule,
+        "ALERT_SYMBOL=" + a.Symbol,
+        "ALERT_VALUE=" + a.Value.String(),
+        "ALERT_MESSAGE=" + a.Message,
+    )
+    out, err := cmd.CombinedOutput()
+    if err != nil {
+        if msg := strings.TrimSpace(string(out)); msg != "" {
+            return fmt.Errorf("%v: %v", err, msg)
+        }
+        return err
+    }
+    return nil
+}
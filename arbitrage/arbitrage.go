@@ -0,0 +1,251 @@
+// Package arbitrage looks for price differences between exchanges in
+// AllExchanges snapshots: the best bid and ask for each currency, the
+// spread between them before and after fees, and when it opens up.
+package arbitrage
+
+import (
+    "context"
+    "sort"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+// Scale is the number of decimal places net spreads are rounded to.
+const Scale = 8
+
+// Fee is an exchange's trading fee, as a percentage of the traded amount.
+type Fee struct {
+    Buy             bapi.Decimal    `json:"buy"`
+    Sell            bapi.Decimal    `json:"sell"`
+}
+
+// Options tunes Analyze.
+type Options struct {
+    // Fees holds the fee schedule of each exchange. Exchanges not in it pay
+    // DefaultFee.
+    Fees            map[string]Fee
+    DefaultFee      Fee
+    // MinVolume leaves out exchanges that traded less BTC than this.
+    MinVolume       bapi.Decimal
+}
+
+func (o *Options) fee(exchange string) Fee {
+    if f, ok := o.Fees[exchange]; ok { return f }
+    return o.DefaultFee
+}
+
+// Opportunity is the best trade between two exchanges for a currency: buy
+// at the ask of one, sell at the bid of the other.
+type Opportunity struct {
+    Symbol          string          `json:"symbol"`
+    BuyExchange     string          `json:"buy_exchange"`
+    Ask             bapi.Decimal    `json:"ask"`
+    SellExchange    string          `json:"sell_exchange"`
+    Bid             bapi.Decimal    `json:"bid"`
+    // Spread is Bid - Ask, and SpreadPercent that as a percentage of Ask.
+    Spread          bapi.Decimal    `json:"spread"`
+    SpreadPercent   bapi.Decimal    `json:"spread_percent"`
+    // NetSpread is the spread per BTC after paying the fees of both
+    // exchanges, and NetPercent that as a percentage of the cost of buying.
+    NetSpread       bapi.Decimal    `json:"net_spread"`
+    NetPercent      bapi.Decimal    `json:"net_percent"`
+    Timestamp       time.Time       `json:"timestamp"`
+}
+
+// Profitable tells whether the opportunity makes money after fees.
+func (o *Opportunity) Profitable() bool {
+    return o.NetSpread.Sign() > 0
+}
+
+type quote struct {
+    exchange        string
+    // cost is what buying one BTC really costs, fees included, and
+    // proceeds what selling one really brings in.
+    ask, cost       bapi.Decimal
+    bid, proceeds   bapi.Decimal
+}
+
+// Analyze finds the best opportunity for every currency quoted by at least
+// two exchanges, and returns them ranked by NetPercent, best first. Ties are
+// broken by symbol. A nil opts means no fees.
+func Analyze(all *bapi.AllExchanges, opts *Options) []Opportunity {
+    if opts == nil { opts = &Options{} }
+
+    var ops []Opportunity
+    for symbol, exchanges := range all.Exchanges {
+        if o, ok := best(symbol, exchanges, opts); ok {
+            o.Timestamp = all.Timestamp
+            ops = append(ops, o)
+        }
+    }
+    sort.Slice(ops, func(i, j int) bool {
+        if c := ops[i].NetPercent.Cmp(ops[j].NetPercent); c != 0 { return c > 0 }
+        return ops[i].Symbol < ops[j].Symbol
+    })
+    return ops
+}
+
+// best picks the pair of distinct exchanges with the widest spread after
+// fees. Exchanges are few enough for trying every pair to be cheap.
+func best(symbol string, exchanges map[string]bapi.Exchange, opts *Options) (Opportunity, bool) {
+    names := make([]string, 0, len(exchanges))
+    for name := range exchanges { names = append(names, name) }
+    sort.Strings(names)
+
+    // Fees are percentages, cent turns them into fractions.
+    one, cent := bapi.NewDecimal(1, 0), bapi.NewDecimal(1, 2)
+    var quotes []quote
+    for _, name := range names {
+        ex := exchanges[name]
+        if opts.MinVolume.Sign() > 0 && ex.VolumeBTC.Cmp(opts.MinVolume) < 0 { continue }
+        if ex.Rates.Ask.Sign() <= 0 || ex.Rates.Bid.Sign() <= 0 { continue }
+        fee := opts.fee(name)
+        quotes = append(quotes, quote{
+            exchange: name,
+            ask:      ex.Rates.Ask,
+            cost:     ex.Rates.Ask.Mul(one.Add(fee.Buy.Mul(cent))),
+            bid:      ex.Rates.Bid,
+            proceeds: ex.Rates.Bid.Mul(one.Sub(fee.Sell.Mul(cent))),
+        })
+    }
+
+    var buy, sell *quote
+    var net bapi.Decimal
+    for i := range quotes {
+        for j := range quotes {
+            if i == j { continue }
+            n := quotes[j].proceeds.Sub(quotes[i].cost)
+            if buy == nil || n.Cmp(net) > 0 {
+                buy, sell, net = &quotes[i], &quotes[j], n
+            }
+        }
+    }
+    if buy == nil { return Opportunity{}, false }
+
+    o := Opportunity{
+        Symbol:       symbol,
+        BuyExchange:  buy.exchange,
+        Ask:          buy.ask,
+        SellExchange: sell.exchange,
+        Bid:          sell.bid,
+        Spread:       sell.bid.Sub(buy.ask),
+        NetSpread:    net.Round(Scale, bapi.RoundHalfEven),
+    }
+    o.SpreadPercent = o.Spread.PercentOf(buy.ask)
+    o.NetPercent = net.PercentOf(buy.cost)
+    return o, true
+}
+
+type EventKind string
+
+const (
+    // Opened is sent when a currency's net spread reaches the level.
+    Opened          EventKind = "opened"
+    // Changed is sent when the best pair of exchanges changes while the
+    // spread stays at or above the level.
+    Changed         EventKind = "changed"
+    // Closed is sent when the net spread falls back below the level.
+    Closed          EventKind = "closed"
+)
+
+// Event reports a change in the opportunities a Scanner tracks.
+type Event struct {
+    Kind            EventKind       `json:"kind"`
+    Opportunity     Opportunity     `json:"opportunity"`
+}
+
+// Scanner polls AllExchanges and reports when spreads open and close.
+type Scanner struct {
+    Client          bapi.Client
+    Options         Options
+    // Level is the NetPercent an opportunity needs to be reported.
+    Level           bapi.Decimal
+    // Interval is the time between polls. Zero means a minute.
+    Interval        time.Duration
+    // OnError, if set, is called with every failed poll.
+    OnError         func(error)
+
+    open            map[string]Opportunity
+}
+
+// NewScanner returns a Scanner that polls c once a minute, upstream's
+// update cadence, and reports net spreads of level percent or more.
+func NewScanner(c bapi.Client, level bapi.Decimal) *Scanner {
+    return &Scanner{Client: c, Level: level, Interval: time.Minute}
+}
+
+// Update analyzes a snapshot and returns the events it gives rise to,
+// ordered by symbol. Run calls it on every poll; it is exported for callers
+// who get their snapshots elsewhere, such as a replay.Player.
+func (s *Scanner) Update(all *bapi.AllExchanges) []Event {
+    if s.open == nil { s.open = make(map[string]Opportunity) }
+
+    var events []Event
+    seen := make(map[string]bool)
+    for _, o := range Analyze(all, &s.Options) {
+        seen[o.Symbol] = true
+        prev, wasOpen := s.open[o.Symbol]
+        if o.NetPercent.Cmp(s.Level) < 0 {
+            if wasOpen {
+                delete(s.open, o.Symbol)
+                events = append(events, Event{Kind: Closed, Opportunity: o})
+            }
+            continue
+        }
+        s.open[o.Symbol] = o
+        switch {
+        case !wasOpen:
+            events = append(events, Event{Kind: Opened, Opportunity: o})
+        case prev.BuyExchange != o.BuyExchange || prev.SellExchange != o.SellExchange:
+            events = append(events, Event{Kind: Changed, Opportunity: o})
+        }
+    }
+    // Currencies that dropped out of the snapshot altogether.
+    for symbol, o := range s.open {
+        if seen[symbol] { continue }
+        delete(s.open, symbol)
+        o.Timestamp = all.Timestamp
+        events = append(events, Event{Kind: Closed, Opportunity: o})
+    }
+
+    sort.SliceStable(events, func(i, j int) bool {
+        return events[i].Opportunity.Symbol < events[j].Opportunity.Symbol
+    })
+    return events
+}
+
+// Run polls every Interval and sends events on the returned channel, which
+// is closed once ctx is done. A Scanner must not Run more than once at a
+// time.
+func (s *Scanner) Run(ctx context.Context) <-chan Event {
+    ch := make(chan Event)
+    go func() {
+        defer close(ch)
+        interval := s.Interval
+        if interval <= 0 { interval = time.Minute }
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            all, err := s.Client.AllExchangesContext(ctx)
+            if err != nil {
+                if ctx.Err() != nil { return }
+                if s.OnError != nil { s.OnError(err) }
+            } else {
+                for _, e := range s.Update(all) {
+                    select {
+                    case ch <- e:
+                    case <-ctx.Done():
+                        return
+                    }
+                }
+            }
+            select {
+            case <-ticker.C:
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+    return ch
+}
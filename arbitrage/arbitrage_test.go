@@ -0,0 +1,124 @@
+package arbitrage
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func dec(s string) bapi.Decimal {
+    return bapi.MustParseDecimal(s)
+}
+
+func ex(ask, bid string) bapi.Exchange {
+    return bapi.Exchange{Rates: bapi.ExchangeRates{Ask: dec(ask), Bid: dec(bid)}, VolumeBTC: dec("10")}
+}
+
+func TestAnalyze(t *testing.T) {
+    all := &bapi.AllExchanges{Exchanges: map[string]map[string]bapi.Exchange{
+        "USD": {"a": ex("100", "99"), "b": ex("101", "102"), "c": ex("0", "0")},
+        "EUR": {"c": ex("200", "199"), "d": ex("201", "198")},
+        "GBP": {"e": ex("150", "149")},
+    }}
+
+    ops := Analyze(all, nil)
+    if len(ops) != 2 || ops[0].Symbol != "USD" || ops[1].Symbol != "EUR" {
+        t.Fatalf("got %+v", ops)
+    }
+    if o := ops[0]; o.BuyExchange != "a" || o.SellExchange != "b" || !o.Spread.Equal(dec("2")) || !o.SpreadPercent.Equal(dec("2")) || !o.Profitable() {
+        t.Errorf("got %+v", o)
+    }
+    if o := ops[1]; !o.Spread.Equal(dec("-2")) || o.Profitable() {
+        t.Errorf("got %+v", o)
+    }
+
+    ops = Analyze(all, &Options{Fees: map[string]Fee{"a": {Buy: dec("0.5")}}, DefaultFee: Fee{Sell: dec("0.5")}})
+    if o := ops[0]; !o.NetSpread.Equal(dec("0.99")) || !o.NetPercent.Equal(dec("0.9851")) || !o.Spread.Equal(dec("2")) {
+        t.Errorf("got %+v", o)
+    }
+
+    // Thin exchanges can be left out.
+    all.Exchanges["USD"]["b"] = bapi.Exchange{Rates: bapi.ExchangeRates{Ask: dec("101"), Bid: dec("102")}, VolumeBTC: dec("1")}
+    ops = Analyze(all, &Options{MinVolume: dec("5")})
+    if len(ops) != 1 || ops[0].Symbol != "EUR" {
+        t.Errorf("got %+v", ops)
+    }
+}
+
+func TestScanner(t *testing.T) {
+    s := NewScanner(nil, dec("1"))
+    snap := func(bid string) *bapi.AllExchanges {
+        return &bapi.AllExchanges{Exchanges: map[string]map[string]bapi.Exchange{
+            "USD": {"a": ex("100", "99"), "b": ex("101", bid)},
+        }}
+    }
+
+    for i, c := range []struct{
+        bid     string
+        want    []EventKind
+    }{
+        {"102", []EventKind{Opened}},
+        {"103", nil},
+        {"100.5", []EventKind{Closed}},
+        {"100.5", nil},
+        {"101", []EventKind{Opened}},
+    } {
+        events := s.Update(snap(c.bid))
+        if len(events) != len(c.want) {
+            t.Fatalf("%v: got %+v, want %v", i, events, c.want)
+        }
+        for j, e := range events {
+            if e.Kind != c.want[j] || e.Opportunity.Symbol != "USD" {
+                t.Errorf("%v: got %+v, want %v", i, e, c.want[j])
+            }
+        }
+    }
+
+    // A currency that disappears is closed.
+    events := s.Update(&bapi.AllExchanges{})
+    if len(events) != 1 || events[0].Kind != Closed {
+        t.Errorf("got %+v", events)
+    }
+}
+
+func TestScannerRun(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    s := NewScanner(srv.APIClient(), dec("0.05"))
+    s.Interval = 5 * time.Millisecond
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    events := s.Run(ctx)
+    e := <-events
+    o := e.Opportunity
+    if e.Kind != Opened || o.Symbol != "USD" || o.BuyExchange != "btce" || o.SellExchange != "bitfinex" || !o.NetPercent.Equal(dec("0.091")) {
+        t.Errorf("got %+v", e)
+    }
+    if o.Timestamp.IsZero() {
+        t.Error("no timestamp")
+    }
+
+    cancel()
+    for range events {}
+}
+
+func TestScannerDefaultInterval(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    // A bare Scanner polls once a minute rather than panic.
+    s := &Scanner{Client: srv.APIClient(), Level: dec("0.05")}
+    ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+    defer cancel()
+
+    n := 0
+    for range s.Run(ctx) { n++ }
+    if n != 1 || len(srv.Requests()) != 1 {
+        t.Errorf("got %v events from %v polls, want 1 of each", n, len(srv.Requests()))
+    }
+}
@@ -0,0 +1,410 @@
+// Package archive keeps bapi history on disk beyond the upstream sliding
+// windows. Every symbol and resolution gets its own series, stored as a
+// sequence of segment files:
+//
+//     <dir>/<symbol>/<resolution>/00000001.seg
+//
+// Each segment holds up to SegmentSize records, one per line, as
+//
+//     <unix seconds>,<high>,<low>,<average>,<volume>
+//
+// Segments are append-only. New records are appended to the last segment;
+// older ones missing from the series, backfills, go into new segments of
+// their own. Records within a segment are strictly increasing in time, but
+// segments may overlap: reads merge them back into order.
+package archive
+
+import (
+    "bufio"
+    "context"
+    "io/ioutil"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "errors"
+    "sync"
+    "sort"
+    "time"
+    "fmt"
+    "os"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+// SegmentSize is the number of records after which a new segment is started.
+var SegmentSize = 10000
+
+// Source is what Sync needs from a client. Any bapi.Client implements it.
+type Source interface {
+    MinutelyHistoryContext(ctx context.Context, symbol string) ([]bapi.MinutelyHistoryRecord, error)
+    HourlyHistoryContext(ctx context.Context, symbol string) ([]bapi.HourlyHistoryRecord, error)
+    DailyHistoryContext(ctx context.Context, symbol string) ([]bapi.DailyHistoryRecord, error)
+}
+
+// Store is an on-disk archive of history series. It is safe for concurrent
+// use, but only one Store may have a directory open at a time.
+type Store struct {
+    dir             string
+
+    mu              sync.Mutex
+    series          map[string]*series
+}
+
+type segment struct {
+    path            string
+    first           time.Time
+    last            time.Time
+    count           int
+}
+
+type series struct {
+    dir             string
+    segments        []*segment
+    active          *os.File
+}
+
+func (s *series) count() int {
+    n := 0
+    for _, seg := range s.segments {
+        n += seg.count
+    }
+    return n
+}
+
+func (s *series) last() time.Time {
+    // Backfills can make any segment the newest one.
+    var last time.Time
+    for _, seg := range s.segments {
+        if seg.count > 0 && seg.last.After(last) { last = seg.last }
+    }
+    return last
+}
+
+// SyncResult tells how many new records Sync archived for each resolution.
+type SyncResult struct {
+    Added           map[bapi.Resolution]int
+}
+
+// Open opens the archive in dir, creating it if needed.
+func Open(dir string) (*Store, error) {
+    err := os.MkdirAll(dir, 0755)
+    if err != nil { return nil, err }
+    return &Store{dir: dir, series: make(map[string]*series)}, nil
+}
+
+// Close releases the files held open by the store.
+func (st *Store) Close() error {
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    var err error
+    for _, s := range st.series {
+        if s.active == nil { continue }
+        if cerr := s.active.Close(); err == nil { err = cerr }
+        s.active = nil
+    }
+    return err
+}
+
+func seriesKey(symbol string, res bapi.Resolution) string {
+    return symbol + "/" + res.String()
+}
+
+// load returns the series for symbol and res, scanning its segments the
+// first time round. The caller must hold st.mu.
+func (st *Store) load(symbol string, res bapi.Resolution) (*series, error) {
+    if res == bapi.ResolutionAuto || strings.ContainsAny(symbol, "/\\.") || symbol == "" {
+        return nil, fmt.Errorf("invalid series %v/%v.", symbol, res)
+    }
+
+    key := seriesKey(symbol, res)
+    if s, ok := st.series[key]; ok { return s, nil }
+
+    s := &series{dir: filepath.Join(st.dir, symbol, res.String())}
+    err := os.MkdirAll(s.dir, 0755)
+    if err != nil { return nil, err }
+
+    names, err := filepath.Glob(filepath.Join(s.dir, "*.seg"))
+    if err != nil { return nil, err }
+    sort.Strings(names)
+
+    for i, name := range names {
+        seg := &segment{path: name}
+        err = scanSegment(name, i == len(names) - 1, func(r bapi.HistoryRecord) error {
+            if seg.count == 0 { seg.first = r.DateTime }
+            seg.last = r.DateTime
+            seg.count++
+            return nil
+        })
+        if err != nil { return nil, err }
+        if seg.count > 0 || i == len(names) - 1 {
+            s.segments = append(s.segments, seg)
+        }
+    }
+
+    st.series[key] = s
+    return s, nil
+}
+
+// scanSegment calls fn for every record in the segment at path. A torn last
+// line, left behind by a crash mid-append, is cut off if repair is set and
+// ignored otherwise.
+func scanSegment(path string, repair bool, fn func(bapi.HistoryRecord) error) error {
+    data, err := ioutil.ReadFile(path)
+    if err != nil { return err }
+
+    if end := strings.LastIndexByte(string(data), '\n') + 1; end < len(data) {
+        data = data[:end]
+        if repair {
+            err = os.Truncate(path, int64(end))
+            if err != nil { return err }
+        }
+    }
+
+    sc := bufio.NewScanner(strings.NewReader(string(data)))
+    for line := 1; sc.Scan(); line++ {
+        r, err := decodeRecord(sc.Text())
+        if err != nil { return fmt.Errorf("%v:%v: %v", path, line, err) }
+        err = fn(r)
+        if err != nil { return err }
+    }
+    return sc.Err()
+}
+
+func encodeRecord(r bapi.HistoryRecord) string {
+    return fmt.Sprintf("%d,%v,%v,%v,%v\n", r.DateTime.Unix(), r.High, r.Low, r.Average, r.Volume)
+}
+
+func decodeRecord(line string) (bapi.HistoryRecord, error) {
+    var r bapi.HistoryRecord
+    f := strings.Split(line, ",")
+    if len(f) != 5 { return r, errors.New("malformed record.") }
+
+    secs, err := strconv.ParseInt(f[0], 10, 64)
+    if err != nil { return r, err }
+    r.DateTime = time.Unix(secs, 0).UTC()
+
+    for i, d := range []*bapi.Decimal{&r.High, &r.Low, &r.Average, &r.Volume} {
+        *d, err = bapi.ParseDecimal(f[i+1])
+        if err != nil { return r, err }
+    }
+    return r, nil
+}
+
+// Append archives the records of rs not yet stored for symbol at res,
+// keeping the series in chronological order and without duplicates: records
+// whose time is already stored are skipped, the first of several with the
+// same time wins. Records older than the last one stored are written to new
+// segments rather than into the ones they fall in. It returns how many were
+// added.
+func (st *Store) Append(symbol string, res bapi.Resolution, rs []bapi.HistoryRecord) (int, error) {
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    s, err := st.load(symbol, res)
+    if err != nil { return 0, err }
+
+    sorted := append([]bapi.HistoryRecord(nil), rs...)
+    sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].DateTime.Before(sorted[j].DateTime) })
+
+    last := s.last()
+    have := s.count() > 0
+    older := 0
+    for have && older < len(sorted) && !sorted[older].DateTime.After(last) { older++ }
+    added, err := s.backfill(sorted[:older])
+    if err != nil { return added, err }
+
+    for _, r := range sorted[older:] {
+        if have && !r.DateTime.After(last) { continue }
+        err = s.append(r)
+        if err != nil { return added, err }
+        last = r.DateTime
+        have = true
+        added++
+    }
+
+    if s.active != nil && added > 0 {
+        err = s.active.Sync()
+    }
+    return added, err
+}
+
+// backfill writes the records of rs, sorted and none of them past the end of
+// the series, that the series doesn't have yet to new segments of their own.
+// Existing segments are left untouched. It returns how many were written.
+func (s *series) backfill(rs []bapi.HistoryRecord) (int, error) {
+    if len(rs) == 0 { return 0, nil }
+
+    from, to := rs[0].DateTime, rs[len(rs)-1].DateTime
+    stored := make(map[int64]bool)
+    for _, seg := range s.segments {
+        if seg.count == 0 || seg.last.Before(from) || seg.first.After(to) { continue }
+        err := scanSegment(seg.path, false, func(r bapi.HistoryRecord) error {
+            stored[r.DateTime.Unix()] = true
+            return nil
+        })
+        if err != nil { return 0, err }
+    }
+
+    var fresh []bapi.HistoryRecord
+    for _, r := range rs {
+        if stored[r.DateTime.Unix()] { continue }
+        stored[r.DateTime.Unix()] = true
+        fresh = append(fresh, r)
+    }
+
+    added := 0
+    for len(fresh) > 0 {
+        n := len(fresh)
+        if n > SegmentSize { n = SegmentSize }
+        err := s.create(fresh[:n])
+        if err != nil { return added, err }
+        added += n
+        fresh = fresh[n:]
+    }
+    return added, nil
+}
+
+// create writes rs to a new segment at the end of the series. The segment
+// is written under a temporary name and renamed into place, so that a crash
+// leaves either all of rs or none of it.
+func (s *series) create(rs []bapi.HistoryRecord) error {
+    // Appends move on to the new segment.
+    err := s.closeActive()
+    if err != nil { return err }
+
+    var buf strings.Builder
+    for _, r := range rs { buf.WriteString(encodeRecord(r)) }
+    seg := &segment{path: s.nextPath(), first: rs[0].DateTime, last: rs[len(rs)-1].DateTime, count: len(rs)}
+    tmp := seg.path + ".tmp"
+    err = writeFileSync(tmp, buf.String())
+    if err != nil { return err }
+    err = os.Rename(tmp, seg.path)
+    if err != nil { return err }
+
+    s.segments = append(s.segments, seg)
+    return nil
+}
+
+// nextPath returns the path of the segment following the last one.
+func (s *series) nextPath() string {
+    seq := 1
+    if n := len(s.segments); n > 0 {
+        prev, _ := strconv.Atoi(strings.TrimSuffix(filepath.Base(s.segments[n-1].path), ".seg"))
+        seq = prev + 1
+    }
+    return filepath.Join(s.dir, fmt.Sprintf("%08d.seg", seq))
+}
+
+func (s *series) closeActive() error {
+    if s.active == nil { return nil }
+    err := s.active.Sync()
+    if cerr := s.active.Close(); err == nil { err = cerr }
+    s.active = nil
+    return err
+}
+
+func writeFileSync(path, data string) error {
+    f, err := os.Create(path)
+    if err != nil { return err }
+    _, err = f.WriteString(data)
+    if err == nil { err = f.Sync() }
+    if cerr := f.Close(); err == nil { err = cerr }
+    return err
+}
+
+func (s *series) append(r bapi.HistoryRecord) error {
+    var seg *segment
+    if n := len(s.segments); n > 0 && s.segments[n-1].count < SegmentSize {
+        seg = s.segments[n-1]
+    }
+
+    if seg == nil {
+        err := s.closeActive()
+        if err != nil { return err }
+        seg = &segment{path: s.nextPath()}
+        s.segments = append(s.segments, seg)
+    }
+
+    if s.active == nil {
+        f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+        if err != nil { return err }
+        s.active = f
+    }
+
+    _, err := s.active.WriteString(encodeRecord(r))
+    if err != nil { return err }
+
+    if seg.count == 0 { seg.first = r.DateTime }
+    seg.last = r.DateTime
+    seg.count++
+    return nil
+}
+
+// Last returns the time of the newest record archived for symbol at res.
+func (st *Store) Last(symbol string, res bapi.Resolution) (time.Time, error) {
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    s, err := st.load(symbol, res)
+    if err != nil { return time.Time{}, err }
+    return s.last(), nil
+}
+
+// Range returns the archived records of symbol at res within tr, in
+// chronological order, skipping segments that lie entirely outside of it.
+func (st *Store) Range(symbol string, res bapi.Resolution, tr bapi.TimeRange) ([]bapi.HistoryRecord, error) {
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    s, err := st.load(symbol, res)
+    if err != nil { return nil, err }
+
+    rs := make([]bapi.HistoryRecord, 0)
+    for _, seg := range s.segments {
+        if seg.count == 0 { continue }
+        if !tr.To.IsZero() && !seg.first.Before(tr.To) { continue }
+        if !tr.From.IsZero() && seg.last.Before(tr.From) { continue }
+
+        err = scanSegment(seg.path, false, func(r bapi.HistoryRecord) error {
+            if tr.Contains(r.DateTime) { rs = append(rs, r) }
+            return nil
+        })
+        if err != nil { return nil, err }
+    }
+    sort.SliceStable(rs, func(i, j int) bool { return rs[i].DateTime.Before(rs[j].DateTime) })
+    return rs, nil
+}
+
+// Sync fetches the minutely, hourly and daily history of symbol from src
+// and archives whatever the store doesn't have yet.
+func (st *Store) Sync(ctx context.Context, src Source, symbol string) (*SyncResult, error) {
+    result := &SyncResult{Added: make(map[bapi.Resolution]int)}
+
+    minutely, err := src.MinutelyHistoryContext(ctx, symbol)
+    if err != nil { return result, err }
+    rs := make([]bapi.HistoryRecord, len(minutely))
+    for i, r := range minutely {
+        rs[i] = r.HistoryRecord()
+    }
+    result.Added[bapi.ResolutionMinute], err = st.Append(symbol, bapi.ResolutionMinute, rs)
+    if err != nil { return result, err }
+
+    hourly, err := src.HourlyHistoryContext(ctx, symbol)
+    if err != nil { return result, err }
+    rs = make([]bapi.HistoryRecord, len(hourly))
+    for i, r := range hourly {
+        rs[i] = r.HistoryRecord()
+    }
+    result.Added[bapi.ResolutionHour], err = st.Append(symbol, bapi.ResolutionHour, rs)
+    if err != nil { return result, err }
+
+    daily, err := src.DailyHistoryContext(ctx, symbol)
+    if err != nil { return result, err }
+    rs = make([]bapi.HistoryRecord, len(daily))
+    for i, r := range daily {
+        rs[i] = r.HistoryRecord()
+    }
+    result.Added[bapi.ResolutionDay], err = st.Append(symbol, bapi.ResolutionDay, rs)
+    return result, err
+}
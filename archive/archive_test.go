@@ -0,0 +1,192 @@
+package archive
+
+import (
+    "context"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func TestSync(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+    ctx := context.Background()
+
+    dir, err := ioutil.TempDir("", "archive")
+    if err != nil { t.Fatal(err) }
+    defer os.RemoveAll(dir)
+
+    st, err := Open(dir)
+    if err != nil { t.Fatal(err) }
+    defer st.Close()
+
+    res, err := st.Sync(ctx, c, "USD")
+    if err != nil { t.Fatal(err) }
+    if res.Added[bapi.ResolutionMinute] != 7 || res.Added[bapi.ResolutionHour] != 5 || res.Added[bapi.ResolutionDay] != 6 {
+        t.Errorf("first sync added %v", res.Added)
+    }
+
+    // The window slides: one row scrolls out, one new row comes in.
+    srv.SetFixture("history/USD/per_minute_24h_sliding_window.csv", []byte(`datetime,average
+2014-11-04 14:16:00,329.58
+2014-11-04 14:17:00,329.62
+2014-11-04 14:18:00,329.77
+2014-11-04 14:19:00,329.9
+2014-11-04 14:20:00,329.85
+2014-11-04 14:21:00,329.96
+2014-11-04 14:22:00,330.02
+`))
+    res, err = st.Sync(ctx, c, "USD")
+    if err != nil { t.Fatal(err) }
+    if res.Added[bapi.ResolutionMinute] != 1 || res.Added[bapi.ResolutionHour] != 0 || res.Added[bapi.ResolutionDay] != 0 {
+        t.Errorf("second sync added %v", res.Added)
+    }
+
+    rs, err := st.Range("USD", bapi.ResolutionMinute, bapi.TimeRange{})
+    if err != nil { t.Fatal(err) }
+    if len(rs) != 8 || rs[0].DateTime.Minute() != 15 || !rs[7].Average.Equal(bapi.MustParseDecimal("330.02")) {
+        t.Errorf("got %+v", rs)
+    }
+}
+
+func TestSegments(t *testing.T) {
+    defer func(n int) { SegmentSize = n }(SegmentSize)
+    SegmentSize = 2
+
+    dir, err := ioutil.TempDir("", "archive")
+    if err != nil { t.Fatal(err) }
+    defer os.RemoveAll(dir)
+
+    day := func(d int) bapi.HistoryRecord {
+        return bapi.HistoryRecord{
+            DateTime: time.Date(2014, 11, d, 0, 0, 0, 0, time.UTC),
+            Average:  bapi.NewDecimal(int64(300 + d), 0),
+            Volume:   bapi.MustParseDecimal("1.5"),
+        }
+    }
+
+    st, _ := Open(dir)
+    n, err := st.Append("EUR", bapi.ResolutionDay, []bapi.HistoryRecord{day(3), day(1), day(2), day(2), day(4), day(5)})
+    if err != nil || n != 5 {
+        t.Fatalf("appended %v, %v", n, err)
+    }
+    st.Close()
+
+    segs, _ := filepath.Glob(filepath.Join(dir, "EUR", "day", "*.seg"))
+    if len(segs) != 3 {
+        t.Errorf("got %v segments, want 3", len(segs))
+    }
+
+    // Simulate a crash in the middle of an append.
+    f, _ := os.OpenFile(segs[2], os.O_WRONLY|os.O_APPEND, 0644)
+    f.WriteString("1415404800,0,0,30")
+    f.Close()
+
+    st, _ = Open(dir)
+    defer st.Close()
+    n, err = st.Append("EUR", bapi.ResolutionDay, []bapi.HistoryRecord{day(5), day(6)})
+    if err != nil || n != 1 {
+        t.Fatalf("appended %v, %v", n, err)
+    }
+
+    tr := bapi.TimeRange{From: time.Date(2014, 11, 2, 0, 0, 0, 0, time.UTC), To: time.Date(2014, 11, 6, 0, 0, 0, 0, time.UTC)}
+    rs, err := st.Range("EUR", bapi.ResolutionDay, tr)
+    if err != nil { t.Fatal(err) }
+    if len(rs) != 4 || rs[0].DateTime.Day() != 2 || rs[3].DateTime.Day() != 5 || !rs[3].Volume.Equal(bapi.MustParseDecimal("1.5")) {
+        t.Errorf("got %+v", rs)
+    }
+}
+
+func TestBackfill(t *testing.T) {
+    defer func(n int) { SegmentSize = n }(SegmentSize)
+    SegmentSize = 3
+
+    dir, err := ioutil.TempDir("", "archive")
+    if err != nil { t.Fatal(err) }
+    defer os.RemoveAll(dir)
+
+    at := func(t time.Time, avg int64) bapi.HistoryRecord {
+        return bapi.HistoryRecord{DateTime: t, Average: bapi.NewDecimal(avg, 0)}
+    }
+    day := func(d int) bapi.HistoryRecord {
+        return at(time.Date(2014, 11, d, 0, 0, 0, 0, time.UTC), int64(300 + d))
+    }
+
+    st, _ := Open(dir)
+    n, err := st.Append("EUR", bapi.ResolutionDay, []bapi.HistoryRecord{day(1), day(2), day(4), day(5), day(7), day(8)})
+    if err != nil || n != 6 {
+        t.Fatalf("appended %v, %v", n, err)
+    }
+
+    // Segments are append-only: whatever they hold now must still be there,
+    // unchanged, at the start of them later on.
+    before := make(map[string]string)
+    names, _ := filepath.Glob(filepath.Join(dir, "EUR", "day", "*"))
+    for _, name := range names {
+        data, _ := ioutil.ReadFile(name)
+        before[name] = string(data)
+    }
+
+    // Backfill around and before what's stored, with duplicates of stored
+    // records that must not replace them.
+    dup := day(2)
+    dup.Average = bapi.NewDecimal(1, 0)
+    n, err = st.Append("EUR", bapi.ResolutionDay, []bapi.HistoryRecord{day(3), dup, day(0), day(6), day(8), day(9), day(6)})
+    if err != nil || n != 4 {
+        t.Fatalf("backfilled %v, %v", n, err)
+    }
+
+    // Backfill and append in one go.
+    n, err = st.Append("EUR", bapi.ResolutionDay, []bapi.HistoryRecord{day(10), at(day(9).DateTime.Add(-12 * time.Hour), 1)})
+    if err != nil || n != 2 {
+        t.Fatalf("backfilled %v, %v", n, err)
+    }
+    st.Close()
+
+    st, _ = Open(dir)
+    defer st.Close()
+    rs, err := st.Range("EUR", bapi.ResolutionDay, bapi.TimeRange{})
+    if err != nil { t.Fatal(err) }
+    if len(rs) != 12 {
+        t.Fatalf("got %v records, want 12: %+v", len(rs), rs)
+    }
+    for i := 1; i < len(rs); i++ {
+        if !rs[i].DateTime.After(rs[i-1].DateTime) {
+            t.Errorf("record %v at %v is not after %v", i, rs[i].DateTime, rs[i-1].DateTime)
+        }
+    }
+    if !rs[2].Average.Equal(bapi.NewDecimal(302, 0)) {
+        t.Errorf("stored record was replaced by %v", rs[2].Average)
+    }
+    if last, _ := st.Last("EUR", bapi.ResolutionDay); !last.Equal(day(10).DateTime) {
+        t.Errorf("got last %v, want %v", last, day(10).DateTime)
+    }
+
+    // Segments overlap now, so a range has to be put back in order too.
+    rs, err = st.Range("EUR", bapi.ResolutionDay, bapi.TimeRange{From: day(5).DateTime, To: day(9).DateTime})
+    if err != nil { t.Fatal(err) }
+    var got []int
+    for _, r := range rs { got = append(got, r.DateTime.Day()) }
+    if fmt.Sprint(got) != "[5 6 7 8 8]" {
+        t.Errorf("got days %v in range, want [5 6 7 8 8]", got)
+    }
+
+    for name, data := range before {
+        after, err := ioutil.ReadFile(name)
+        if err != nil || !strings.HasPrefix(string(after), data) {
+            t.Errorf("segment %v was rewritten: %q, was %q", name, after, data)
+        }
+    }
+    segs, _ := filepath.Glob(filepath.Join(dir, "EUR", "day", "*"))
+    if len(segs) != 5 {
+        t.Errorf("got %v, want 5 segments and no leftovers", segs)
+    }
+}
@@ -0,0 +1,175 @@
+// Package audit checks the BitcoinAverage index against the per-exchange
+// data it is built from, and that data itself for outliers.
+package audit
+
+import (
+    "context"
+    "sort"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+// Scale is the number of decimal places the recomputed index is worked out
+// to.
+const Scale = 8
+
+// Weighting selects how exchanges are weighted into the index.
+type Weighting int
+
+const (
+    // ByVolumeBTC weights each exchange by its 24h volume in BTC, which is
+    // how upstream builds the index.
+    ByVolumeBTC Weighting = iota
+    // ByVolumePercent uses the published volume share instead. The result
+    // is the same up to upstream's rounding of the shares.
+    ByVolumePercent
+)
+
+// Component is an exchange's part in a recomputed index.
+type Component struct {
+    Exchange        string          `json:"exchange"`
+    Rates           bapi.ExchangeRates `json:"rates"`
+    Weight          bapi.Decimal    `json:"weight"`
+    // Share is the exchange's percentage of the total weight. It is zero
+    // for excluded exchanges.
+    Share           bapi.Decimal    `json:"share"`
+    Excluded        bool            `json:"excluded"`
+    // Reason tells why an exchange was excluded: upstream's own reason for
+    // ignored exchanges, or that there was no usable volume or price.
+    Reason          string          `json:"reason,omitempty"`
+}
+
+// Index is the outcome of recomputing the index for a symbol. Prices are
+// zero when no exchange quotes them.
+type Index struct {
+    Symbol          string          `json:"symbol"`
+    Timestamp       time.Time       `json:"timestamp"`
+    Last            bapi.Decimal    `json:"last"`
+    Bid             bapi.Decimal    `json:"bid"`
+    Ask             bapi.Decimal    `json:"ask"`
+    TotalWeight     bapi.Decimal    `json:"total_weight"`
+    // Components lists every exchange in the list, excluded ones included,
+    // in alphabetical order.
+    Components      []Component     `json:"components"`
+}
+
+// Recompute rebuilds the volume-weighted index for symbol out of its
+// exchange list, leaving out the exchanges in ignored (as returned by
+// bapi.ApiClient.Ignored) along with those without volume or a last price.
+// Each price is averaged over the exchanges that quote it.
+func Recompute(symbol string, el *bapi.ExchangeList, ignored map[string]string, w Weighting) *Index {
+    idx := &Index{Symbol: symbol, Timestamp: el.Timestamp}
+
+    names := make([]string, 0, len(el.Exchanges))
+    for name := range el.Exchanges { names = append(names, name) }
+    sort.Strings(names)
+
+    for _, name := range names {
+        ex := el.Exchanges[name]
+        c := Component{Exchange: name, Rates: ex.Rates, Weight: ex.VolumeBTC}
+        if w == ByVolumePercent { c.Weight = ex.VolumePercent }
+
+        if reason, ok := ignored[name]; ok {
+            c.Excluded, c.Reason = true, reason
+        } else if c.Weight.Sign() <= 0 {
+            c.Excluded, c.Reason = true, "no volume"
+        } else if ex.Rates.Last.Sign() <= 0 {
+            c.Excluded, c.Reason = true, "no last price"
+        } else {
+            idx.TotalWeight = idx.TotalWeight.Add(c.Weight)
+        }
+        idx.Components = append(idx.Components, c)
+    }
+
+    if idx.TotalWeight.Sign() > 0 {
+        for i := range idx.Components {
+            c := &idx.Components[i]
+            if c.Excluded { continue }
+            c.Share = c.Weight.PercentOf(idx.TotalWeight)
+        }
+    }
+    idx.Last = idx.weighted(func(r bapi.ExchangeRates) bapi.Decimal { return r.Last })
+    idx.Bid = idx.weighted(func(r bapi.ExchangeRates) bapi.Decimal { return r.Bid })
+    idx.Ask = idx.weighted(func(r bapi.ExchangeRates) bapi.Decimal { return r.Ask })
+    return idx
+}
+
+// weighted averages a price over the included components that quote it.
+func (idx *Index) weighted(price func(bapi.ExchangeRates) bapi.Decimal) bapi.Decimal {
+    var sum, weight bapi.Decimal
+    for _, c := range idx.Components {
+        p := price(c.Rates)
+        if c.Excluded || p.Sign() <= 0 { continue }
+        sum = sum.Add(p.Mul(c.Weight))
+        weight = weight.Add(c.Weight)
+    }
+    if weight.Sign() == 0 { return bapi.Decimal{} }
+    return sum.Quo(weight, Scale, bapi.RoundHalfEven)
+}
+
+// Divergence compares a recomputed price with the published one.
+type Divergence struct {
+    Field           string          `json:"field"`
+    Computed        bapi.Decimal    `json:"computed"`
+    Published       bapi.Decimal    `json:"published"`
+    // Diff is Computed - Published, and Percent that as a percentage of
+    // Published.
+    Diff            bapi.Decimal    `json:"diff"`
+    Percent         bapi.Decimal    `json:"percent"`
+}
+
+// IndexReport is the outcome of AuditIndex.
+type IndexReport struct {
+    Index           *Index          `json:"index"`
+    Published       bapi.Ticker     `json:"published"`
+    Global          bool            `json:"global"`
+    // Divergences holds one entry per price both sides have, in the order
+    // last, bid, ask.
+    Divergences     []Divergence    `json:"divergences"`
+    // MaxPercent is the largest absolute divergence percentage.
+    MaxPercent      bapi.Decimal    `json:"max_percent"`
+}
+
+// Compare checks idx against a published ticker.
+func Compare(idx *Index, published bapi.Ticker) *IndexReport {
+    r := &IndexReport{Index: idx, Published: published}
+    for _, f := range []struct{
+        name                    string
+        computed, published     bapi.Decimal
+    }{
+        {"last", idx.Last, published.Last},
+        {"bid", idx.Bid, published.Bid},
+        {"ask", idx.Ask, published.Ask},
+    } {
+        if f.computed.Sign() <= 0 || f.published.Sign() <= 0 { continue }
+        d := Divergence{Field: f.name, Computed: f.computed, Published: f.published, Diff: f.computed.Sub(f.published)}
+        d.Percent = d.Diff.PercentOf(f.published)
+        if d.Percent.Abs().Cmp(r.MaxPercent) > 0 { r.MaxPercent = d.Percent.Abs() }
+        r.Divergences = append(r.Divergences, d)
+    }
+    return r
+}
+
+// AuditIndex fetches the exchange list for symbol along with the ignored
+// exchanges, recomputes the index and compares it with the published
+// market ticker, or the global one if global is set. Note the global index
+// blends in other currencies, so expect it to diverge more.
+func AuditIndex(ctx context.Context, c bapi.Client, symbol string, global bool, w Weighting) (*IndexReport, error) {
+    el, err := c.ExchangesContext(ctx, symbol)
+    if err != nil { return nil, err }
+    ignored, err := c.IgnoredContext(ctx)
+    if err != nil { return nil, err }
+
+    var t *bapi.Ticker
+    if global {
+        t, err = c.GlobalTickerContext(ctx, symbol)
+    } else {
+        t, err = c.MarketTickerContext(ctx, symbol)
+    }
+    if err != nil { return nil, err }
+
+    r := Compare(Recompute(symbol, el, ignored, w), *t)
+    r.Global = global
+    return r, nil
+}
@@ -0,0 +1,64 @@
+package audit
+
+import (
+    "context"
+    "testing"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func dec(s string) bapi.Decimal {
+    return bapi.MustParseDecimal(s)
+}
+
+func TestAuditIndex(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    r, err := AuditIndex(context.Background(), srv.APIClient(), "USD", false, ByVolumeBTC)
+    if err != nil { t.Fatal(err) }
+
+    idx := r.Index
+    if !idx.Last.Equal(dec("329.86705695")) || !idx.Bid.Equal(dec("329.53385311")) || !idx.Ask.Equal(dec("330.06831741")) {
+        t.Errorf("got last %v, bid %v, ask %v", idx.Last, idx.Bid, idx.Ask)
+    }
+    if !idx.TotalWeight.Equal(dec("45230.42")) || len(idx.Components) != 3 || !idx.Components[0].Share.Equal(dec("47.6013")) {
+        t.Errorf("got %+v", idx)
+    }
+
+    if len(r.Divergences) != 3 || r.Divergences[0].Field != "last" {
+        t.Fatalf("got %+v", r.Divergences)
+    }
+    if d := r.Divergences[0]; !d.Published.Equal(dec("330.01")) || !d.Diff.Equal(dec("-0.14294305")) || !d.Percent.Equal(dec("-0.0433")) {
+        t.Errorf("got %+v", d)
+    }
+    if r.MaxPercent.Sign() <= 0 {
+        t.Errorf("got max %v", r.MaxPercent)
+    }
+}
+
+func TestRecomputeExclusions(t *testing.T) {
+    el := &bapi.ExchangeList{Exchanges: map[string]bapi.Exchange{
+        "bitfinex": {Rates: bapi.ExchangeRates{Last: dec("330.1")}, VolumeBTC: dec("21530.28")},
+        "bitstamp": {Rates: bapi.ExchangeRates{Last: dec("329.9")}, VolumeBTC: dec("15420.02")},
+        "btce":     {Rates: bapi.ExchangeRates{Last: dec("329.2")}, VolumeBTC: dec("8280.12")},
+        "nada":     {Rates: bapi.ExchangeRates{Last: dec("1")}},
+        "noprice":  {VolumeBTC: dec("100")},
+    }}
+    idx := Recompute("USD", el, map[string]string{"bitfinex": "query fail"}, ByVolumeBTC)
+
+    if !idx.Last.Equal(dec("329.65544094")) {
+        t.Errorf("got last %v", idx.Last)
+    }
+    if !idx.Bid.IsZero() {
+        t.Errorf("got bid %v without quotes", idx.Bid)
+    }
+    reasons := map[string]string{}
+    for _, c := range idx.Components {
+        if c.Excluded { reasons[c.Exchange] = c.Reason }
+    }
+    if len(reasons) != 3 || reasons["bitfinex"] != "query fail" || reasons["nada"] != "no volume" || reasons["noprice"] != "no last price" {
+        t.Errorf("got %v", reasons)
+    }
+}
@@ -0,0 +1,220 @@
+package audit
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+type FindingKind string
+
+const (
+    // Deviation is a price too far from the volume-weighted median.
+    Deviation       FindingKind = "deviation"
+    // CrossedBook is a bid above the ask.
+    CrossedBook     FindingKind = "crossed_book"
+    // Stale is an exchange list older than allowed. Upstream only
+    // timestamps lists as a whole, so stale findings carry no exchange.
+    Stale           FindingKind = "stale"
+)
+
+// Finding is a single problem with an exchange, explained in Detail.
+type Finding struct {
+    Kind            FindingKind     `json:"kind"`
+    Exchange        string          `json:"exchange,omitempty"`
+    // Field is "last", "bid" or "ask" for deviations.
+    Field           string          `json:"field,omitempty"`
+    Value           bapi.Decimal    `json:"value"`
+    // Median is the volume-weighted median Value was compared with. MADs
+    // is how many median absolute deviations away it is, rounded to two
+    // places (zero when the MAD test didn't apply), and Percent how far
+    // away relative to Median.
+    Median          bapi.Decimal    `json:"median"`
+    MADs            float64         `json:"mads"`
+    Percent         bapi.Decimal    `json:"percent"`
+    Detail          string          `json:"detail"`
+}
+
+// OutlierOptions tunes DetectOutliers.
+type OutlierOptions struct {
+    // MADs flags prices further than that many median absolute deviations
+    // from the median. The MAD is taken to be at least 0.01% of the median,
+    // so that a lone outlier among identical prices still stands out. Zero
+    // disables the test.
+    MADs            float64
+    // MinExchanges is the number of exchanges quoting a price needed for
+    // the MAD test to apply: with fewer, the median says little.
+    MinExchanges    int
+    // Percent flags prices further than that percentage from the median.
+    // Zero disables the test.
+    Percent         bapi.Decimal
+    // MaxAge flags exchange lists older than this. Zero disables the test.
+    MaxAge          time.Duration
+    // Now is the time MaxAge is measured from. Zero means time.Now().
+    Now             time.Time
+}
+
+// DefaultOutlierOptions flag prices beyond 5 MADs, given at least 3
+// exchanges, and lists older than 10 minutes.
+var DefaultOutlierOptions = OutlierOptions{MADs: 5, MinExchanges: 3, MaxAge: 10 * time.Minute}
+
+// IgnoredComparison sets our findings against upstream's Ignored() list.
+type IgnoredComparison struct {
+    // Agreed lists the exchanges both flagged.
+    Agreed          []string            `json:"agreed"`
+    // OnlyDetected lists the exchanges only DetectOutliers flagged.
+    OnlyDetected    []string            `json:"only_detected"`
+    // OnlyIgnored holds the exchanges, with upstream's reasons, that
+    // upstream ignores but DetectOutliers didn't flag. Ignored exchanges
+    // are usually missing from exchange lists altogether, so expect this to
+    // hold most of them.
+    OnlyIgnored     map[string]string   `json:"only_ignored"`
+}
+
+// OutlierReport is the outcome of DetectOutliers.
+type OutlierReport struct {
+    Symbol          string          `json:"symbol"`
+    Timestamp       time.Time       `json:"timestamp"`
+    // Medians holds the volume-weighted median of each price.
+    Medians         map[string]bapi.Decimal `json:"medians"`
+    Findings        []Finding       `json:"findings"`
+    // Ignored is only set by AuditOutliers.
+    Ignored         *IgnoredComparison `json:"ignored,omitempty"`
+}
+
+// Flagged returns the exchanges with at least one finding, in alphabetical
+// order.
+func (r *OutlierReport) Flagged() []string {
+    seen := make(map[string]bool)
+    var names []string
+    for _, f := range r.Findings {
+        if f.Exchange == "" || seen[f.Exchange] { continue }
+        seen[f.Exchange] = true
+        names = append(names, f.Exchange)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// CompareIgnored compares the flagged exchanges with upstream's list of
+// ignored ones.
+func (r *OutlierReport) CompareIgnored(ignored map[string]string) *IgnoredComparison {
+    cmp := &IgnoredComparison{OnlyIgnored: make(map[string]string)}
+    flagged := make(map[string]bool)
+    for _, name := range r.Flagged() {
+        flagged[name] = true
+        if _, ok := ignored[name]; ok {
+            cmp.Agreed = append(cmp.Agreed, name)
+        } else {
+            cmp.OnlyDetected = append(cmp.OnlyDetected, name)
+        }
+    }
+    for name, reason := range ignored {
+        if !flagged[name] { cmp.OnlyIgnored[name] = reason }
+    }
+    return cmp
+}
+
+// DetectOutliers checks the exchanges in el for prices far off the
+// volume-weighted median, crossed books, and the list itself for
+// staleness. Exchanges without volume are checked but don't count towards
+// the median. A nil opts means DefaultOutlierOptions.
+func DetectOutliers(symbol string, el *bapi.ExchangeList, opts *OutlierOptions) *OutlierReport {
+    if opts == nil { opts = &DefaultOutlierOptions }
+    r := &OutlierReport{Symbol: symbol, Timestamp: el.Timestamp, Medians: make(map[string]bapi.Decimal)}
+
+    names := make([]string, 0, len(el.Exchanges))
+    for name := range el.Exchanges { names = append(names, name) }
+    sort.Strings(names)
+
+    if opts.MaxAge > 0 && !el.Timestamp.IsZero() {
+        now := opts.Now
+        if now.IsZero() { now = time.Now() }
+        if age := now.Sub(el.Timestamp); age > opts.MaxAge {
+            r.Findings = append(r.Findings, Finding{
+                Kind:   Stale,
+                Detail: fmt.Sprintf("exchange list is %v old, more than %v.", age.Round(time.Second), opts.MaxAge),
+            })
+        }
+    }
+
+    for _, name := range names {
+        rates := el.Exchanges[name].Rates
+        if rates.Bid.Sign() > 0 && rates.Ask.Sign() > 0 && rates.Bid.Cmp(rates.Ask) > 0 {
+            r.Findings = append(r.Findings, Finding{
+                Kind:     CrossedBook,
+                Exchange: name,
+                Value:    rates.Bid,
+                Detail:   fmt.Sprintf("bid %v is above ask %v.", rates.Bid, rates.Ask),
+            })
+        }
+    }
+
+    for _, field := range []struct{
+        name    string
+        price   func(bapi.ExchangeRates) bapi.Decimal
+    }{
+        {"last", func(r bapi.ExchangeRates) bapi.Decimal { return r.Last }},
+        {"bid", func(r bapi.ExchangeRates) bapi.Decimal { return r.Bid }},
+        {"ask", func(r bapi.ExchangeRates) bapi.Decimal { return r.Ask }},
+    } {
+        var prices, volumes []bapi.Decimal
+        for _, name := range names {
+            ex := el.Exchanges[name]
+            p := field.price(ex.Rates)
+            if p.Sign() > 0 && ex.VolumeBTC.Sign() > 0 {
+                prices = append(prices, p)
+                volumes = append(volumes, ex.VolumeBTC)
+            }
+        }
+        if len(prices) == 0 { continue }
+        med, mad := bapi.MedianMAD(prices, volumes)
+        r.Medians[field.name] = med
+        useMAD := opts.MADs > 0 && len(prices) >= opts.MinExchanges
+
+        for _, name := range names {
+            p := field.price(el.Exchanges[name].Rates)
+            if p.Sign() <= 0 { continue }
+            f := Finding{
+                Kind:     Deviation,
+                Exchange: name,
+                Field:    field.name,
+                Value:    p,
+                Median:   med,
+                Percent:  p.Sub(med).PercentOf(med),
+            }
+            var reasons []string
+            if useMAD {
+                f.MADs = p.Sub(med).Abs().Quo(mad, 2, bapi.RoundHalfEven).Float64()
+                if bapi.BeyondMADs(p, med, mad, opts.MADs) { reasons = append(reasons, fmt.Sprintf("%v MADs", f.MADs)) }
+            }
+            if opts.Percent.Sign() > 0 && f.Percent.Abs().Cmp(opts.Percent) > 0 {
+                reasons = append(reasons, fmt.Sprintf("%v%%", f.Percent))
+            }
+            if len(reasons) == 0 { continue }
+
+            f.Detail = fmt.Sprintf("%v %v is %v away from the volume-weighted median %v.", field.name, p, reasons[0], med)
+            if len(reasons) > 1 {
+                f.Detail = fmt.Sprintf("%v %v is %v (%v) away from the volume-weighted median %v.", field.name, p, reasons[0], reasons[1], med)
+            }
+            r.Findings = append(r.Findings, f)
+        }
+    }
+    return r
+}
+
+// AuditOutliers fetches the exchange list for symbol and upstream's ignored
+// exchanges, runs DetectOutliers and compares the two.
+func AuditOutliers(ctx context.Context, c bapi.Client, symbol string, opts *OutlierOptions) (*OutlierReport, error) {
+    el, err := c.ExchangesContext(ctx, symbol)
+    if err != nil { return nil, err }
+    ignored, err := c.IgnoredContext(ctx)
+    if err != nil { return nil, err }
+
+    r := DetectOutliers(symbol, el, opts)
+    r.Ignored = r.CompareIgnored(ignored)
+    return r, nil
+}
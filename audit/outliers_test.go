@@ -0,0 +1,109 @@
+package audit
+
+import (
+    "context"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func TestDetectOutliers(t *testing.T) {
+    last := func(p string) bapi.Exchange {
+        return bapi.Exchange{Rates: bapi.ExchangeRates{Last: dec(p)}, VolumeBTC: dec("10")}
+    }
+    ts := time.Date(2014, 11, 4, 14, 22, 3, 0, time.UTC)
+    el := &bapi.ExchangeList{Timestamp: ts, Exchanges: map[string]bapi.Exchange{
+        "a": last("100"),
+        "b": {Rates: bapi.ExchangeRates{Last: dec("101"), Bid: dec("102"), Ask: dec("101")}, VolumeBTC: dec("10")},
+        "c": last("100.5"),
+        "d": last("99.5"),
+        "e": last("120"),
+    }}
+
+    opts := DefaultOutlierOptions
+    opts.Now = ts.Add(time.Hour)
+    opts.Percent = dec("10")
+    r := DetectOutliers("USD", el, &opts)
+
+    if !r.Medians["last"].Equal(dec("100.5")) {
+        t.Errorf("got medians %v", r.Medians)
+    }
+    if len(r.Findings) != 3 {
+        t.Fatalf("got %+v", r.Findings)
+    }
+    if f := r.Findings[0]; f.Kind != Stale || f.Exchange != "" || !strings.Contains(f.Detail, "1h0m0s old") {
+        t.Errorf("got %+v", f)
+    }
+    if f := r.Findings[1]; f.Kind != CrossedBook || f.Exchange != "b" {
+        t.Errorf("got %+v", f)
+    }
+    f := r.Findings[2]
+    if f.Kind != Deviation || f.Exchange != "e" || f.Field != "last" || f.MADs != 39 || !f.Percent.Equal(dec("19.403")) {
+        t.Errorf("got %+v", f)
+    }
+    if f.Detail != "last 120 is 39 MADs (19.4030%) away from the volume-weighted median 100.5." {
+        t.Errorf("got detail %q", f.Detail)
+    }
+
+    cmp := r.CompareIgnored(map[string]string{"e": "price off", "zz": "query fail"})
+    want := &IgnoredComparison{Agreed: []string{"e"}, OnlyDetected: []string{"b"}, OnlyIgnored: map[string]string{"zz": "query fail"}}
+    if !reflect.DeepEqual(cmp, want) {
+        t.Errorf("got %+v", cmp)
+    }
+
+    // With only two exchanges the MAD test doesn't apply, the percent one
+    // does.
+    el.Exchanges = map[string]bapi.Exchange{"a": last("100"), "e": last("120")}
+    r = DetectOutliers("USD", el, &OutlierOptions{MADs: 5, MinExchanges: 3, Percent: dec("10")})
+    if len(r.Findings) != 1 || r.Findings[0].Exchange != "e" || r.Findings[0].MADs != 0 {
+        t.Errorf("got %+v", r.Findings)
+    }
+}
+
+func TestDetectOutliersFlatMAD(t *testing.T) {
+    last := func(p string) bapi.Exchange {
+        return bapi.Exchange{Rates: bapi.ExchangeRates{Last: dec(p)}, VolumeBTC: dec("10")}
+    }
+    el := &bapi.ExchangeList{Exchanges: map[string]bapi.Exchange{
+        "a": last("100"),
+        "b": last("100"),
+        "c": last("100"),
+        "d": last("1000"),
+    }}
+
+    // Three identical prices make for a zero MAD.
+    r := DetectOutliers("USD", el, nil)
+    if len(r.Findings) != 1 {
+        t.Fatalf("got %+v", r.Findings)
+    }
+    if f := r.Findings[0]; f.Kind != Deviation || f.Exchange != "d" || f.MADs != 90000 {
+        t.Errorf("got %+v", f)
+    }
+
+    // 5.004 MADs away rounds down to 5, but is still over the threshold.
+    el.Exchanges = map[string]bapi.Exchange{
+        "a": last("99"),
+        "b": last("100"),
+        "c": last("101"),
+        "d": last("105.004"),
+    }
+    r = DetectOutliers("USD", el, nil)
+    if len(r.Findings) != 1 || r.Findings[0].Exchange != "d" || r.Findings[0].MADs != 5 {
+        t.Errorf("got %+v", r.Findings)
+    }
+}
+
+func TestAuditOutliers(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    r, err := AuditOutliers(context.Background(), srv.APIClient(), "USD", &OutlierOptions{MADs: 5, MinExchanges: 3})
+    if err != nil { t.Fatal(err) }
+    if len(r.Findings) != 0 || r.Ignored == nil || len(r.Ignored.OnlyIgnored) != 3 {
+        t.Errorf("got %+v, %+v", r.Findings, r.Ignored)
+    }
+}
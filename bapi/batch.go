@@ -0,0 +1,130 @@
+package bapi
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// DefaultBatchWorkers is the number of concurrent requests Batch makes
+// unless told otherwise.
+const DefaultBatchWorkers = 4
+
+// BatchOptions tunes Batch. A nil *BatchOptions means the defaults.
+type BatchOptions struct {
+    // Workers bounds the number of requests in flight. Zero means
+    // DefaultBatchWorkers.
+    Workers         int
+    // AllowPartial keeps going when a symbol fails, leaving the error in its
+    // result. Otherwise the first failure cancels the requests not yet made
+    // and the batch returns a *BatchError.
+    AllowPartial    bool
+}
+
+// BatchError reports the symbols a batch failed on.
+type BatchError struct {
+    Errors          map[string]error
+}
+
+func (e *BatchError) Error() string {
+    symbols := make([]string, 0, len(e.Errors))
+    for s := range e.Errors { symbols = append(symbols, s) }
+    sort.Strings(symbols)
+
+    msgs := make([]string, len(symbols))
+    for i, s := range symbols { msgs[i] = fmt.Sprintf("%v: %v", s, e.Errors[s]) }
+    return fmt.Sprintf("batch failed for %v symbol(s): %v", len(symbols), strings.Join(msgs, "; "))
+}
+
+// BatchResult is the outcome of fetching a single symbol.
+type BatchResult[T any] struct {
+    Symbol          string
+    Value           T
+    Err             error
+}
+
+// BatchResults maps every symbol of a batch to its result. Symbols skipped
+// because the batch was cancelled first carry the context's error.
+type BatchResults[T any] map[string]BatchResult[T]
+
+// InOrder returns the results for symbols in that order, typically the
+// symbols the batch was given. Duplicates and symbols without a result are
+// skipped.
+func (rs BatchResults[T]) InOrder(symbols []string) []BatchResult[T] {
+    seen := make(map[string]bool, len(symbols))
+    out := make([]BatchResult[T], 0, len(rs))
+    for _, s := range symbols {
+        r, ok := rs[s]
+        if !ok || seen[s] { continue }
+        seen[s] = true
+        out = append(out, r)
+    }
+    return out
+}
+
+// Batch calls fetch for every symbol, a few at a time, and returns the
+// results keyed by symbol. Symbols given more than once are fetched once.
+// Any Client method taking a symbol will do for fetch, e.g.:
+//
+//     rs, err := bapi.Batch(ctx, symbols, nil, c.ExchangesContext)
+//
+// When c is an ApiClient, its rate limiter and retry policy apply to every
+// request as usual. Unless opts allows partial failure, the results come
+// back along with a *BatchError if any symbol failed.
+func Batch[T any](ctx context.Context, symbols []string, opts *BatchOptions, fetch func(context.Context, string) (T, error)) (BatchResults[T], error) {
+    if opts == nil { opts = &BatchOptions{} }
+
+    var unique []string
+    seen := make(map[string]bool, len(symbols))
+    for _, s := range symbols {
+        if seen[s] { continue }
+        seen[s] = true
+        unique = append(unique, s)
+    }
+
+    workers := opts.Workers
+    if workers <= 0 { workers = DefaultBatchWorkers }
+    if workers > len(unique) { workers = len(unique) }
+
+    bctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    var mu sync.Mutex
+    rs := make(BatchResults[T], len(unique))
+    failed := make(map[string]error)
+
+    jobs := make(chan string)
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for symbol := range jobs {
+                var v T
+                err := bctx.Err()
+                if err == nil { v, err = fetch(bctx, symbol) }
+
+                mu.Lock()
+                rs[symbol] = BatchResult[T]{Symbol: symbol, Value: v, Err: err}
+                // Requests cut short because another symbol failed are not
+                // failures of their own.
+                cut := len(failed) > 0 && bctx.Err() != nil && errors.Is(err, bctx.Err())
+                if err != nil && !cut {
+                    failed[symbol] = err
+                    if !opts.AllowPartial { cancel() }
+                }
+                mu.Unlock()
+            }
+        }()
+    }
+    for _, s := range unique { jobs <- s }
+    close(jobs)
+    wg.Wait()
+
+    if err := ctx.Err(); err != nil { return rs, err }
+    if len(failed) > 0 && !opts.AllowPartial { return rs, &BatchError{Errors: failed} }
+    return rs, nil
+}
@@ -0,0 +1,107 @@
+package bapi_test
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func TestBatch(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+    ctx := context.Background()
+
+    symbols := []string{"USD", "XXX", "USD"}
+    rs, err := bapi.Batch(ctx, symbols, &bapi.BatchOptions{AllowPartial: true}, c.ExchangesContext)
+    if err != nil { t.Fatal(err) }
+    if len(rs) != 2 || len(srv.Requests()) != 2 {
+        t.Fatalf("got %v results from %v requests, want 2 of each: %+v", len(rs), len(srv.Requests()), rs)
+    }
+    if r := rs["USD"]; r.Err != nil || r.Value == nil || len(r.Value.Exchanges) == 0 {
+        t.Errorf("USD: got %+v", r)
+    }
+    if r := rs["XXX"]; !errors.Is(r.Err, bapi.ErrUnknownSymbol) || r.Value != nil {
+        t.Errorf("XXX: got %+v", r)
+    }
+    ordered := rs.InOrder(symbols)
+    if len(ordered) != 2 || ordered[0].Symbol != "USD" || ordered[1].Symbol != "XXX" {
+        t.Errorf("got %+v in order", ordered)
+    }
+
+    _, err = bapi.Batch(ctx, []string{"USD", "XXX"}, nil, c.DailyHistoryContext)
+    var be *bapi.BatchError
+    if !errors.As(err, &be) || len(be.Errors) != 1 || !errors.Is(be.Errors["XXX"], bapi.ErrUnknownSymbol) {
+        t.Errorf("got %v", err)
+    }
+}
+
+func TestBatchCancellation(t *testing.T) {
+    // The first failure cancels the rest, which aren't blamed for it. A
+    // request failing for a reason of its own meanwhile still is.
+    started := make(chan struct{})
+    rs, err := bapi.Batch(context.Background(), []string{"A", "B", "C", "D"}, &bapi.BatchOptions{Workers: 2}, func(ctx context.Context, symbol string) (*bapi.Ticker, error) {
+        switch symbol {
+        case "A":
+            <-started
+            return nil, errors.New("boom.")
+        case "B":
+            close(started)
+            <-ctx.Done()
+            return nil, errors.New("bang.")
+        }
+        return nil, ctx.Err()
+    })
+    var be *bapi.BatchError
+    if !errors.As(err, &be) || len(be.Errors) != 2 || be.Errors["A"] == nil || be.Errors["B"] == nil {
+        t.Fatalf("got %v", err)
+    }
+    if len(rs) != 4 || !errors.Is(rs["C"].Err, context.Canceled) || !errors.Is(rs["D"].Err, context.Canceled) {
+        t.Errorf("got %+v", rs)
+    }
+
+    // Cancelling the batch itself is reported as such.
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    if _, err = bapi.Batch(ctx, []string{"USD"}, nil, bapi.NewWithOptions("http://127.0.0.1:1").GlobalTickerContext); !errors.Is(err, context.Canceled) {
+        t.Errorf("got %v, want context.Canceled", err)
+    }
+}
+
+func TestBatchWorkers(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    var mu sync.Mutex
+    inFlight, peak := 0, 0
+    srv.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+        mu.Lock()
+        inFlight++
+        if inFlight > peak { peak = inFlight }
+        mu.Unlock()
+        time.Sleep(10 * time.Millisecond)
+        mu.Lock()
+        inFlight--
+        mu.Unlock()
+        fmt.Fprintf(w, `{"last": 1, "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000", "symbol": %q}`, strings.TrimPrefix(r.URL.Path, "/ticker/"))
+        return true
+    })
+
+    symbols := []string{"AAA", "BBB", "CCC", "DDD", "EEE", "FFF", "GGG", "HHH"}
+    rs, err := bapi.Batch(context.Background(), symbols, &bapi.BatchOptions{Workers: 2}, bapi.NewWithOptions(srv.URL).MarketTickerContext)
+    if err != nil { t.Fatal(err) }
+    if len(rs) != len(symbols) {
+        t.Errorf("got %v results", len(rs))
+    }
+    if peak != 2 {
+        t.Errorf("got %v requests in flight, want 2", peak)
+    }
+}
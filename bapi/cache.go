@@ -0,0 +1,167 @@
+package bapi
+
+import (
+    "container/list"
+    "crypto/sha1"
+    "encoding/hex"
+    "encoding/json"
+    "io/ioutil"
+    "path/filepath"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+    "os"
+)
+
+// CacheEntry is a cached API response along with what's needed to revalidate
+// it once it expires.
+type CacheEntry struct {
+    Body            []byte
+    ETag            string
+    LastModified    string
+    Expires         time.Time
+}
+
+// Cache stores raw API responses keyed by endpoint. Implementations must be
+// safe for concurrent use and must not modify entries handed to them.
+type Cache interface {
+    Get(key string) (*CacheEntry, bool)
+    Set(key string, e *CacheEntry)
+}
+
+// CacheStats counts what happened to each request that went through a
+// client's cache.
+type CacheStats struct {
+    Hits            int64
+    Misses          int64
+    Revalidations   int64
+}
+
+// WithCache enables response caching. ttl decides how long responses for
+// each endpoint stay fresh; DefaultCacheTTL is used if it is nil. Endpoints
+// with a zero TTL are not cached.
+func WithCache(cache Cache, ttl func(endpoint string) time.Duration) Option {
+    return func(c *ApiClient) {
+        if ttl == nil { ttl = DefaultCacheTTL }
+        c.cache = cache
+        c.cacheTTL = ttl
+    }
+}
+
+// DefaultCacheTTL follows the upstream update cadence: tickers and exchange
+// data change about once a minute, history files much less often.
+func DefaultCacheTTL(endpoint string) time.Duration {
+    switch {
+    case strings.HasSuffix(endpoint, "per_minute_24h_sliding_window.csv"):
+        return time.Minute
+    case strings.HasSuffix(endpoint, "per_hour_monthly_sliding_window.csv"):
+        return 10 * time.Minute
+    case strings.HasSuffix(endpoint, ".csv"):
+        return time.Hour
+    case strings.HasSuffix(endpoint, "/"), endpoint == "ignored":
+        return 5 * time.Minute
+    }
+    return time.Minute
+}
+
+// CacheStats returns a snapshot of the client's cache counters.
+func (c *ApiClient) CacheStats() CacheStats {
+    return CacheStats{
+        Hits:          atomic.LoadInt64(&c.stats.Hits),
+        Misses:        atomic.LoadInt64(&c.stats.Misses),
+        Revalidations: atomic.LoadInt64(&c.stats.Revalidations),
+    }
+}
+
+// MemoryCache is an in-memory Cache that evicts the least recently used
+// entry once it holds more than its configured number of entries.
+type MemoryCache struct {
+    mu              sync.Mutex
+    size            int
+    order           *list.List
+    items           map[string]*list.Element
+}
+
+type memoryItem struct {
+    key             string
+    entry           *CacheEntry
+}
+
+func NewMemoryCache(size int) *MemoryCache {
+    return &MemoryCache{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (mc *MemoryCache) Get(key string) (*CacheEntry, bool) {
+    mc.mu.Lock()
+    defer mc.mu.Unlock()
+
+    el, ok := mc.items[key]
+    if !ok { return nil, false }
+    mc.order.MoveToFront(el)
+    return el.Value.(*memoryItem).entry, true
+}
+
+func (mc *MemoryCache) Set(key string, e *CacheEntry) {
+    mc.mu.Lock()
+    defer mc.mu.Unlock()
+
+    if el, ok := mc.items[key]; ok {
+        el.Value.(*memoryItem).entry = e
+        mc.order.MoveToFront(el)
+        return
+    }
+
+    mc.items[key] = mc.order.PushFront(&memoryItem{key: key, entry: e})
+    for mc.size > 0 && mc.order.Len() > mc.size {
+        el := mc.order.Back()
+        mc.order.Remove(el)
+        delete(mc.items, el.Value.(*memoryItem).key)
+    }
+}
+
+// DiskCache is a Cache that keeps one JSON file per entry in a directory,
+// so that cached responses survive restarts.
+type DiskCache struct {
+    dir             string
+}
+
+// NewDiskCache creates dir if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+    err := os.MkdirAll(dir, 0755)
+    if err != nil { return nil, err }
+    return &DiskCache{dir: dir}, nil
+}
+
+func (dc *DiskCache) path(key string) string {
+    sum := sha1.Sum([]byte(key))
+    return filepath.Join(dc.dir, hex.EncodeToString(sum[:]) + ".json")
+}
+
+func (dc *DiskCache) Get(key string) (*CacheEntry, bool) {
+    data, err := ioutil.ReadFile(dc.path(key))
+    if err != nil { return nil, false }
+
+    var e CacheEntry
+    if json.Unmarshal(data, &e) != nil { return nil, false }
+    return &e, true
+}
+
+// Set writes e atomically. Errors are dropped: a failed write just means a
+// cache miss later on.
+func (dc *DiskCache) Set(key string, e *CacheEntry) {
+    data, err := json.Marshal(e)
+    if err != nil { return }
+
+    tmp, err := ioutil.TempFile(dc.dir, ".tmp-")
+    if err != nil { return }
+    _, err = tmp.Write(data)
+    if cerr := tmp.Close(); err == nil { err = cerr }
+    if err != nil {
+        os.Remove(tmp.Name())
+        return
+    }
+    if os.Rename(tmp.Name(), dc.path(key)) != nil {
+        os.Remove(tmp.Name())
+    }
+}
@@ -0,0 +1,177 @@
+package bapi_test
+
+import (
+    "io/ioutil"
+    "net/http"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+// etag returns the ETag srv serves endpoint with.
+func etag(t *testing.T, srv *bapitest.Server, endpoint string) string {
+    resp, err := http.Get(srv.URL + "/" + endpoint)
+    if err != nil { t.Fatal(err) }
+    resp.Body.Close()
+    return resp.Header.Get("ETag")
+}
+
+func TestCache(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    ttl := time.Hour
+    c := bapi.NewWithOptions(srv.URL, bapi.WithCache(bapi.NewMemoryCache(10), func(string) time.Duration { return ttl }))
+
+    for i := 0; i < 3; i++ {
+        _, err := c.GlobalTicker("USD")
+        if err != nil { t.Fatal(err) }
+    }
+    if got, want := c.CacheStats(), (bapi.CacheStats{Hits: 2, Misses: 1}); got != want {
+        t.Errorf("got %+v, want %+v", got, want)
+    }
+
+    // Stale entries get revalidated rather than downloaded again.
+    cache := bapi.NewMemoryCache(10)
+    c = bapi.NewWithOptions(srv.URL, bapi.WithCache(cache, nil))
+    cache.Set("ticker/global/USD", &bapi.CacheEntry{Body: []byte(`{"last": 1}`), ETag: etag(t, srv, "ticker/global/USD")})
+    tk, err := c.GlobalTicker("USD")
+    if err != nil { t.Fatal(err) }
+    if !tk.Last.Equal(dec("1")) {
+        t.Errorf("got Last %v, want the cached value", tk.Last)
+    }
+    if got := c.CacheStats().Revalidations; got != 1 {
+        t.Errorf("got %v revalidations, want 1", got)
+    }
+    if got := srv.Requests()[len(srv.Requests())-1].Header.Get("If-None-Match"); got == "" {
+        t.Error("request was not conditional")
+    }
+}
+
+func TestCacheRevalidation(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    cache := bapi.NewMemoryCache(10)
+    c := bapi.NewWithOptions(srv.URL, bapi.WithCache(cache, nil))
+
+    // A stale entry that changed upstream is replaced.
+    cache.Set("ticker/global/USD", &bapi.CacheEntry{Body: []byte(`{"last": 1}`), ETag: `"old"`})
+    tk, err := c.GlobalTicker("USD")
+    if err != nil { t.Fatal(err) }
+    if !tk.Last.Equal(dec("329.97")) {
+        t.Errorf("got Last %v, want the fresh value", tk.Last)
+    }
+    e, _ := cache.Get("ticker/global/USD")
+    if e.ETag != etag(t, srv, "ticker/global/USD") || !e.Expires.After(time.Now()) {
+        t.Errorf("entry not replaced: %+v", e)
+    }
+    if got, want := c.CacheStats(), (bapi.CacheStats{Misses: 1}); got != want {
+        t.Errorf("got %+v, want %+v", got, want)
+    }
+
+    // Entries with only a Last-Modified date revalidate with it.
+    const lastModified = "Tue, 04 Nov 2014 14:22:03 GMT"
+    srv.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+        if r.Header.Get("If-Modified-Since") != lastModified { return false }
+        w.WriteHeader(http.StatusNotModified)
+        return true
+    })
+    stale := time.Now().Add(-time.Minute)
+    cache.Set("ignored", &bapi.CacheEntry{Body: []byte(`{"x": "y"}`), LastModified: lastModified, Expires: stale})
+    im, err := c.Ignored()
+    if err != nil { t.Fatal(err) }
+    if im["x"] != "y" {
+        t.Errorf("got %v, want the cached value", im)
+    }
+    e, _ = cache.Get("ignored")
+    if !e.Expires.After(time.Now()) || e.LastModified != lastModified {
+        t.Errorf("entry not refreshed: %+v", e)
+    }
+    if got := c.CacheStats().Revalidations; got != 1 {
+        t.Errorf("got %v revalidations, want 1", got)
+    }
+
+    // Endpoints with a zero TTL are never stored.
+    c = bapi.NewWithOptions(srv.URL, bapi.WithCache(cache, func(string) time.Duration { return 0 }))
+    if _, err := c.Exchanges("USD"); err != nil { t.Fatal(err) }
+    if _, ok := cache.Get("exchanges/USD"); ok {
+        t.Error("zero TTL entry was cached")
+    }
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+    mc := bapi.NewMemoryCache(2)
+    mc.Set("a", &bapi.CacheEntry{Body: []byte("a")})
+    mc.Set("b", &bapi.CacheEntry{Body: []byte("b")})
+    mc.Get("a")
+    mc.Set("c", &bapi.CacheEntry{Body: []byte("c")})
+
+    if _, ok := mc.Get("b"); ok {
+        t.Error("least recently used entry was kept")
+    }
+    for _, key := range []string{"a", "c"} {
+        if e, ok := mc.Get(key); !ok || string(e.Body) != key {
+            t.Errorf("%v: got %+v, %v", key, e, ok)
+        }
+    }
+}
+
+func TestDiskCache(t *testing.T) {
+    dir := filepath.Join(t.TempDir(), "cache")
+    dc, err := bapi.NewDiskCache(dir)
+    if err != nil { t.Fatal(err) }
+
+    if _, ok := dc.Get("ticker/global/USD"); ok {
+        t.Error("hit on an empty cache")
+    }
+    want := &bapi.CacheEntry{Body: []byte(`{"last": 1}`), ETag: `"x"`, LastModified: "yesterday", Expires: time.Now().Add(time.Hour).Round(0)}
+    dc.Set("ticker/global/USD", want)
+
+    // Entries survive the DiskCache that wrote them.
+    dc, err = bapi.NewDiskCache(dir)
+    if err != nil { t.Fatal(err) }
+    got, ok := dc.Get("ticker/global/USD")
+    if !ok || string(got.Body) != string(want.Body) || got.ETag != want.ETag || got.LastModified != want.LastModified || !got.Expires.Equal(want.Expires) {
+        t.Errorf("got %+v, want %+v", got, want)
+    }
+
+    files, _ := ioutil.ReadDir(dir)
+    if len(files) != 1 {
+        t.Errorf("got %v files, want 1 and no leftovers", len(files))
+    }
+
+    // Corrupt entries are misses.
+    ioutil.WriteFile(dc.Path("ignored"), []byte("{"), 0644)
+    if _, ok := dc.Get("ignored"); ok {
+        t.Error("hit on a corrupt entry")
+    }
+
+    // And it works as a client cache.
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL, bapi.WithCache(dc, nil))
+    for i := 0; i < 2; i++ {
+        if _, err := c.Exchanges("USD"); err != nil { t.Fatal(err) }
+    }
+    if got, want := c.CacheStats(), (bapi.CacheStats{Hits: 1, Misses: 1}); got != want || len(srv.Requests()) != 1 {
+        t.Errorf("got %+v after %v requests, want %+v", got, len(srv.Requests()), want)
+    }
+}
+
+func TestDefaultCacheTTL(t *testing.T) {
+    for endpoint, want := range map[string]time.Duration{
+        "ticker/global/USD":                                time.Minute,
+        "ticker/global/":                                   5 * time.Minute,
+        "ignored":                                          5 * time.Minute,
+        "history/USD/per_minute_24h_sliding_window.csv":    time.Minute,
+        "history/USD/per_hour_monthly_sliding_window.csv":  10 * time.Minute,
+        "history/USD/per_day_all_time_history.csv":         time.Hour,
+    } {
+        if got := bapi.DefaultCacheTTL(endpoint); got != want {
+            t.Errorf("%v: got %v, want %v", endpoint, got, want)
+        }
+    }
+}
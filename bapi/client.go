@@ -0,0 +1,255 @@
+package bapi
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+// Client is the method set of ApiClient, for code that wants to accept any
+// implementation: the HTTP client itself, a CachedClient, a replay.Player,
+// a replay.Recorder or the client of a bapitest.Server.
+type Client interface {
+    GlobalTickerList() ([]string, error)
+    GlobalTickerListContext(ctx context.Context) ([]string, error)
+    MarketTickerList() ([]string, error)
+    MarketTickerListContext(ctx context.Context) ([]string, error)
+    ExchangeList() ([]string, error)
+    ExchangeListContext(ctx context.Context) ([]string, error)
+    HistoryList() ([]string, error)
+    HistoryListContext(ctx context.Context) ([]string, error)
+
+    GlobalTicker(symbol string) (*Ticker, error)
+    GlobalTickerContext(ctx context.Context, symbol string) (*Ticker, error)
+    MarketTicker(symbol string) (*Ticker, error)
+    MarketTickerContext(ctx context.Context, symbol string) (*Ticker, error)
+    GlobalTickers() (*AllTickers, error)
+    GlobalTickersContext(ctx context.Context) (*AllTickers, error)
+    MarketTickers() (*AllTickers, error)
+    MarketTickersContext(ctx context.Context) (*AllTickers, error)
+
+    Exchanges(symbol string) (*ExchangeList, error)
+    ExchangesContext(ctx context.Context, symbol string) (*ExchangeList, error)
+    AllExchanges() (*AllExchanges, error)
+    AllExchangesContext(ctx context.Context) (*AllExchanges, error)
+
+    MinutelyHistory(symbol string) ([]MinutelyHistoryRecord, error)
+    MinutelyHistoryContext(ctx context.Context, symbol string) ([]MinutelyHistoryRecord, error)
+    MinutelyHistoryEach(ctx context.Context, symbol string, fn func(MinutelyHistoryRecord) error) error
+    MinutelyHistoryRange(symbol string, tr TimeRange) ([]MinutelyHistoryRecord, error)
+    MinutelyHistoryRangeContext(ctx context.Context, symbol string, tr TimeRange) ([]MinutelyHistoryRecord, error)
+    HourlyHistory(symbol string) ([]HourlyHistoryRecord, error)
+    HourlyHistoryContext(ctx context.Context, symbol string) ([]HourlyHistoryRecord, error)
+    HourlyHistoryEach(ctx context.Context, symbol string, fn func(HourlyHistoryRecord) error) error
+    HourlyHistoryRange(symbol string, tr TimeRange) ([]HourlyHistoryRecord, error)
+    HourlyHistoryRangeContext(ctx context.Context, symbol string, tr TimeRange) ([]HourlyHistoryRecord, error)
+    DailyHistory(symbol string) ([]DailyHistoryRecord, error)
+    DailyHistoryContext(ctx context.Context, symbol string) ([]DailyHistoryRecord, error)
+    DailyHistoryEach(ctx context.Context, symbol string, fn func(DailyHistoryRecord) error) error
+    DailyHistoryRange(symbol string, tr TimeRange) ([]DailyHistoryRecord, error)
+    DailyHistoryRangeContext(ctx context.Context, symbol string, tr TimeRange) ([]DailyHistoryRecord, error)
+    VolumeHistory(symbol string) ([]VolumeHistoryRecord, error)
+    VolumeHistoryContext(ctx context.Context, symbol string) ([]VolumeHistoryRecord, error)
+    VolumeHistoryEach(ctx context.Context, symbol string, fn func(VolumeHistoryRecord) error) error
+    History(symbol string, res Resolution, tr TimeRange) ([]HistoryRecord, Resolution, error)
+    HistoryContext(ctx context.Context, symbol string, res Resolution, tr TimeRange) ([]HistoryRecord, Resolution, error)
+
+    Ignored() (map[string]string, error)
+    IgnoredContext(ctx context.Context) (map[string]string, error)
+}
+
+var _ Client = (*ApiClient)(nil)
+
+// CachedClient memoizes the parsed results of another Client for a fixed
+// time. Unlike the response cache set up with WithCache, it works with any
+// Client, at the cost of handing the very same values to every caller:
+// treat them as read-only. Streaming and range queries are passed through.
+type CachedClient struct {
+    Client
+
+    ttl             time.Duration
+    mu              sync.Mutex
+    entries         map[string]cachedResult
+}
+
+type cachedResult struct {
+    value           interface{}
+    expires         time.Time
+}
+
+var _ Client = (*CachedClient)(nil)
+
+func NewCachedClient(c Client, ttl time.Duration) *CachedClient {
+    return &CachedClient{Client: c, ttl: ttl, entries: make(map[string]cachedResult)}
+}
+
+// Purge forgets every memoized result.
+func (cc *CachedClient) Purge() {
+    cc.mu.Lock()
+    defer cc.mu.Unlock()
+    cc.entries = make(map[string]cachedResult)
+}
+
+func (cc *CachedClient) get(key string, fetch func() (interface{}, error)) (interface{}, error) {
+    now := time.Now()
+    cc.mu.Lock()
+    e, ok := cc.entries[key]
+    cc.mu.Unlock()
+    if ok && now.Before(e.expires) { return e.value, nil }
+
+    v, err := fetch()
+    if err != nil { return nil, err }
+
+    cc.mu.Lock()
+    cc.entries[key] = cachedResult{value: v, expires: now.Add(cc.ttl)}
+    cc.mu.Unlock()
+    return v, nil
+}
+
+func (cc *CachedClient) list(key string, fetch func() ([]string, error)) ([]string, error) {
+    v, err := cc.get(key, func() (interface{}, error) { return fetch() })
+    if err != nil { return nil, err }
+    return v.([]string), nil
+}
+
+func (cc *CachedClient) GlobalTickerList() ([]string, error) {
+    return cc.GlobalTickerListContext(context.Background())
+}
+
+func (cc *CachedClient) GlobalTickerListContext(ctx context.Context) ([]string, error) {
+    return cc.list("GlobalTickerList", func() ([]string, error) { return cc.Client.GlobalTickerListContext(ctx) })
+}
+
+func (cc *CachedClient) MarketTickerList() ([]string, error) {
+    return cc.MarketTickerListContext(context.Background())
+}
+
+func (cc *CachedClient) MarketTickerListContext(ctx context.Context) ([]string, error) {
+    return cc.list("MarketTickerList", func() ([]string, error) { return cc.Client.MarketTickerListContext(ctx) })
+}
+
+func (cc *CachedClient) ExchangeList() ([]string, error) {
+    return cc.ExchangeListContext(context.Background())
+}
+
+func (cc *CachedClient) ExchangeListContext(ctx context.Context) ([]string, error) {
+    return cc.list("ExchangeList", func() ([]string, error) { return cc.Client.ExchangeListContext(ctx) })
+}
+
+func (cc *CachedClient) HistoryList() ([]string, error) {
+    return cc.HistoryListContext(context.Background())
+}
+
+func (cc *CachedClient) HistoryListContext(ctx context.Context) ([]string, error) {
+    return cc.list("HistoryList", func() ([]string, error) { return cc.Client.HistoryListContext(ctx) })
+}
+
+func (cc *CachedClient) GlobalTicker(symbol string) (*Ticker, error) {
+    return cc.GlobalTickerContext(context.Background(), symbol)
+}
+
+func (cc *CachedClient) GlobalTickerContext(ctx context.Context, symbol string) (*Ticker, error) {
+    v, err := cc.get("GlobalTicker/" + symbol, func() (interface{}, error) { return cc.Client.GlobalTickerContext(ctx, symbol) })
+    if err != nil { return nil, err }
+    return v.(*Ticker), nil
+}
+
+func (cc *CachedClient) MarketTicker(symbol string) (*Ticker, error) {
+    return cc.MarketTickerContext(context.Background(), symbol)
+}
+
+func (cc *CachedClient) MarketTickerContext(ctx context.Context, symbol string) (*Ticker, error) {
+    v, err := cc.get("MarketTicker/" + symbol, func() (interface{}, error) { return cc.Client.MarketTickerContext(ctx, symbol) })
+    if err != nil { return nil, err }
+    return v.(*Ticker), nil
+}
+
+func (cc *CachedClient) GlobalTickers() (*AllTickers, error) {
+    return cc.GlobalTickersContext(context.Background())
+}
+
+func (cc *CachedClient) GlobalTickersContext(ctx context.Context) (*AllTickers, error) {
+    v, err := cc.get("GlobalTickers", func() (interface{}, error) { return cc.Client.GlobalTickersContext(ctx) })
+    if err != nil { return nil, err }
+    return v.(*AllTickers), nil
+}
+
+func (cc *CachedClient) MarketTickers() (*AllTickers, error) {
+    return cc.MarketTickersContext(context.Background())
+}
+
+func (cc *CachedClient) MarketTickersContext(ctx context.Context) (*AllTickers, error) {
+    v, err := cc.get("MarketTickers", func() (interface{}, error) { return cc.Client.MarketTickersContext(ctx) })
+    if err != nil { return nil, err }
+    return v.(*AllTickers), nil
+}
+
+func (cc *CachedClient) Exchanges(symbol string) (*ExchangeList, error) {
+    return cc.ExchangesContext(context.Background(), symbol)
+}
+
+func (cc *CachedClient) ExchangesContext(ctx context.Context, symbol string) (*ExchangeList, error) {
+    v, err := cc.get("Exchanges/" + symbol, func() (interface{}, error) { return cc.Client.ExchangesContext(ctx, symbol) })
+    if err != nil { return nil, err }
+    return v.(*ExchangeList), nil
+}
+
+func (cc *CachedClient) AllExchanges() (*AllExchanges, error) {
+    return cc.AllExchangesContext(context.Background())
+}
+
+func (cc *CachedClient) AllExchangesContext(ctx context.Context) (*AllExchanges, error) {
+    v, err := cc.get("AllExchanges", func() (interface{}, error) { return cc.Client.AllExchangesContext(ctx) })
+    if err != nil { return nil, err }
+    return v.(*AllExchanges), nil
+}
+
+func (cc *CachedClient) MinutelyHistory(symbol string) ([]MinutelyHistoryRecord, error) {
+    return cc.MinutelyHistoryContext(context.Background(), symbol)
+}
+
+func (cc *CachedClient) MinutelyHistoryContext(ctx context.Context, symbol string) ([]MinutelyHistoryRecord, error) {
+    v, err := cc.get("MinutelyHistory/" + symbol, func() (interface{}, error) { return cc.Client.MinutelyHistoryContext(ctx, symbol) })
+    if err != nil { return nil, err }
+    return v.([]MinutelyHistoryRecord), nil
+}
+
+func (cc *CachedClient) HourlyHistory(symbol string) ([]HourlyHistoryRecord, error) {
+    return cc.HourlyHistoryContext(context.Background(), symbol)
+}
+
+func (cc *CachedClient) HourlyHistoryContext(ctx context.Context, symbol string) ([]HourlyHistoryRecord, error) {
+    v, err := cc.get("HourlyHistory/" + symbol, func() (interface{}, error) { return cc.Client.HourlyHistoryContext(ctx, symbol) })
+    if err != nil { return nil, err }
+    return v.([]HourlyHistoryRecord), nil
+}
+
+func (cc *CachedClient) DailyHistory(symbol string) ([]DailyHistoryRecord, error) {
+    return cc.DailyHistoryContext(context.Background(), symbol)
+}
+
+func (cc *CachedClient) DailyHistoryContext(ctx context.Context, symbol string) ([]DailyHistoryRecord, error) {
+    v, err := cc.get("DailyHistory/" + symbol, func() (interface{}, error) { return cc.Client.DailyHistoryContext(ctx, symbol) })
+    if err != nil { return nil, err }
+    return v.([]DailyHistoryRecord), nil
+}
+
+func (cc *CachedClient) VolumeHistory(symbol string) ([]VolumeHistoryRecord, error) {
+    return cc.VolumeHistoryContext(context.Background(), symbol)
+}
+
+func (cc *CachedClient) VolumeHistoryContext(ctx context.Context, symbol string) ([]VolumeHistoryRecord, error) {
+    v, err := cc.get("VolumeHistory/" + symbol, func() (interface{}, error) { return cc.Client.VolumeHistoryContext(ctx, symbol) })
+    if err != nil { return nil, err }
+    return v.([]VolumeHistoryRecord), nil
+}
+
+func (cc *CachedClient) Ignored() (map[string]string, error) {
+    return cc.IgnoredContext(context.Background())
+}
+
+func (cc *CachedClient) IgnoredContext(ctx context.Context) (map[string]string, error) {
+    v, err := cc.get("Ignored", func() (interface{}, error) { return cc.Client.IgnoredContext(ctx) })
+    if err != nil { return nil, err }
+    return v.(map[string]string), nil
+}
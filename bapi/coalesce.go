@@ -0,0 +1,96 @@
+package bapi
+
+import (
+    "context"
+    "sync"
+)
+
+// By default, concurrent identical calls to an ApiClient share a single
+// fetch: the first one starts it, the others wait for it, and all of them
+// get the very same parsed result or error. Calls are identical when they
+// are to the same method with the same arguments. Shared results must be
+// treated as read-only. Streaming calls (the Each methods) are never
+// coalesced.
+//
+// Every caller waits on its own context, and the fetch goes on until the
+// last one waiting for it gives up. As it serves several callers at once, it
+// runs on a context of its own, with none of their values.
+//
+// WithoutCoalescing makes every call fetch on its own, on the caller's
+// context. Use it if the transport relies on context values.
+func WithoutCoalescing() Option {
+    return func(c *ApiClient) {
+        c.flights = nil
+    }
+}
+
+// flightGroup tracks the calls in flight per key.
+type flightGroup struct {
+    mu              sync.Mutex
+    flights         map[string]*flight
+}
+
+type flight struct {
+    done            chan struct{}
+    value           interface{}
+    err             error
+    // waiters is the number of callers still waiting for the flight.
+    waiters         int
+    cancel          context.CancelFunc
+}
+
+// shared runs fetch, or joins the call for key already in flight if there is
+// one and coalescing is on. key must tell apart every method and argument
+// that makes a difference to the result.
+func (c *ApiClient) shared(ctx context.Context, key string, fetch func(context.Context) (interface{}, error)) (interface{}, error) {
+    if c.flights == nil { return fetch(ctx) }
+    return c.flights.do(ctx, key, fetch)
+}
+
+// do runs fn for key, unless a call for key is in flight already, in which
+// case it waits for that one instead. fn is cancelled only once every
+// caller waiting for it has given up.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+    if err := ctx.Err(); err != nil { return nil, err }
+
+    g.mu.Lock()
+    if g.flights == nil { g.flights = make(map[string]*flight) }
+    f, ok := g.flights[key]
+    if !ok {
+        fctx, cancel := context.WithCancel(context.Background())
+        f = &flight{done: make(chan struct{}), cancel: cancel}
+        g.flights[key] = f
+        go func() {
+            f.value, f.err = fn(fctx)
+            g.mu.Lock()
+            g.forget(key, f)
+            g.mu.Unlock()
+            cancel()
+            close(f.done)
+        }()
+    }
+    f.waiters++
+    g.mu.Unlock()
+
+    select {
+    case <-f.done:
+        return f.value, f.err
+    case <-ctx.Done():
+        g.mu.Lock()
+        f.waiters--
+        if f.waiters == 0 {
+            f.cancel()
+            // Later callers start afresh rather than join a cancelled
+            // flight.
+            g.forget(key, f)
+        }
+        g.mu.Unlock()
+        return nil, ctx.Err()
+    }
+}
+
+// forget removes f from the group, if it is still the flight for key. The
+// caller holds g.mu.
+func (g *flightGroup) forget(key string, f *flight) {
+    if g.flights[key] == f { delete(g.flights, key) }
+}
@@ -0,0 +1,189 @@
+package bapi_test
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+// blockingServer holds every request until release is closed, and reports
+// on aborted when a held request is cancelled by the client.
+func blockingServer(t *testing.T) (srv *bapitest.Server, release chan struct{}, aborted chan struct{}) {
+    srv = bapitest.NewServer()
+    t.Cleanup(srv.Close)
+    release, aborted = make(chan struct{}), make(chan struct{}, 10)
+    srv.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+        select {
+        case <-release:
+            return false
+        case <-r.Context().Done():
+            aborted <- struct{}{}
+            return true
+        }
+    })
+    return srv, release, aborted
+}
+
+func waitRequests(t *testing.T, srv *bapitest.Server, n int) {
+    deadline := time.Now().Add(time.Second)
+    for len(srv.Requests()) < n {
+        if time.Now().After(deadline) { t.Fatalf("got %v requests, want %v", len(srv.Requests()), n) }
+        time.Sleep(time.Millisecond)
+    }
+}
+
+func TestCoalescing(t *testing.T) {
+    srv, release, _ := blockingServer(t)
+    c := bapi.NewWithOptions(srv.URL)
+
+    var wg sync.WaitGroup
+    results := make([]*bapi.AllTickers, 20)
+    errs := make([]error, len(results))
+    for i := range results {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            results[i], errs[i] = c.GlobalTickers()
+        }(i)
+    }
+    waitRequests(t, srv, 1)
+    time.Sleep(20 * time.Millisecond)
+    close(release)
+    wg.Wait()
+
+    if got := len(srv.Requests()); got != 1 {
+        t.Errorf("got %v requests, want 1", got)
+    }
+    for i := range results {
+        if errs[i] != nil || len(results[i].Tickers) == 0 {
+            t.Fatalf("%v: got %+v, %v", i, results[i], errs[i])
+        }
+        // The result is parsed once, for everyone.
+        if results[i] != results[0] {
+            t.Fatal("results are not shared")
+        }
+    }
+
+    // WithoutCoalescing turns it off.
+    srv, release, _ = blockingServer(t)
+    c = bapi.NewWithOptions(srv.URL, bapi.WithoutCoalescing())
+    for i := 0; i < 2; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            results[i], errs[i] = c.GlobalTickers()
+        }(i)
+    }
+    waitRequests(t, srv, 2)
+    close(release)
+    wg.Wait()
+    if errs[0] != nil || errs[1] != nil || results[0] == results[1] {
+        t.Errorf("got %v, %v without coalescing", errs[0], errs[1])
+    }
+}
+
+func TestCoalescingKeys(t *testing.T) {
+    srv, release, _ := blockingServer(t)
+    c := bapi.NewWithOptions(srv.URL)
+    ctx := context.Background()
+
+    // Calls differing in method or arguments don't share, even when they
+    // hit the same endpoint.
+    day := func(d int) time.Time { return time.Date(2014, 11, d, 0, 0, 0, 0, time.UTC) }
+    var wg sync.WaitGroup
+    counts := make([]int, 4)
+    errs := make([]error, len(counts))
+    for i, call := range []func() (int, error){
+        func() (int, error) { rs, err := c.DailyHistoryContext(ctx, "USD"); return len(rs), err },
+        func() (int, error) { rs, err := c.DailyHistoryRangeContext(ctx, "USD", bapi.TimeRange{From: day(3)}); return len(rs), err },
+        func() (int, error) { rs, err := c.DailyHistoryRangeContext(ctx, "USD", bapi.TimeRange{To: day(3)}); return len(rs), err },
+        func() (int, error) { rs, err := c.DailyHistoryRangeContext(ctx, "USD", bapi.TimeRange{From: day(3)}); return len(rs), err },
+    } {
+        wg.Add(1)
+        go func(i int, call func() (int, error)) {
+            defer wg.Done()
+            counts[i], errs[i] = call()
+        }(i, call)
+    }
+    waitRequests(t, srv, 3)
+    time.Sleep(20 * time.Millisecond)
+    close(release)
+    wg.Wait()
+
+    for i, want := range []int{6, 1, 5, 1} {
+        if errs[i] != nil || counts[i] != want {
+            t.Errorf("call %v: got %v records, %v, want %v", i, counts[i], errs[i], want)
+        }
+    }
+    if got := len(srv.Requests()); got != 3 {
+        t.Errorf("got %v requests, want 3", got)
+    }
+}
+
+func TestCoalescingWaiterDeadline(t *testing.T) {
+    srv, release, _ := blockingServer(t)
+    c := bapi.NewWithOptions(srv.URL)
+
+    // A waiter with a deadline doesn't impose it on the shared fetch, nor
+    // inherit the lack of one.
+    done := make(chan error)
+    go func() { _, err := c.GlobalTickers(); done <- err }()
+    waitRequests(t, srv, 1)
+    ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Millisecond)
+    defer cancel()
+    if _, err := c.GlobalTickersContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("got %v, want context.DeadlineExceeded", err)
+    }
+    close(release)
+    if err := <-done; err != nil { t.Error(err) }
+}
+
+func TestCoalescingCancellation(t *testing.T) {
+    srv, release, aborted := blockingServer(t)
+    c := bapi.NewWithOptions(srv.URL)
+
+    // A waiter giving up leaves the request running for the others.
+    ctx1, cancel1 := context.WithCancel(context.Background())
+    done1, done2 := make(chan error), make(chan error)
+    go func() { _, err := c.GlobalTickersContext(ctx1); done1 <- err }()
+    waitRequests(t, srv, 1)
+    go func() { _, err := c.GlobalTickersContext(context.Background()); done2 <- err }()
+    time.Sleep(20 * time.Millisecond)
+
+    cancel1()
+    if err := <-done1; !errors.Is(err, context.Canceled) {
+        t.Errorf("got %v, want context.Canceled", err)
+    }
+    select {
+    case <-aborted:
+        t.Fatal("request aborted with a waiter left")
+    case <-time.After(20 * time.Millisecond):
+    }
+    close(release)
+    if err := <-done2; err != nil { t.Error(err) }
+    if got := len(srv.Requests()); got != 1 {
+        t.Errorf("got %v requests, want 1", got)
+    }
+
+    // Once every waiter is gone, so is the request.
+    srv, _, aborted = blockingServer(t)
+    c = bapi.NewWithOptions(srv.URL)
+    ctx, cancel := context.WithCancel(context.Background())
+    for i := 0; i < 2; i++ {
+        go c.GlobalTickersContext(ctx)
+    }
+    waitRequests(t, srv, 1)
+    time.Sleep(20 * time.Millisecond)
+    cancel()
+    select {
+    case <-aborted:
+    case <-time.After(time.Second):
+        t.Fatal("request not aborted")
+    }
+}
@@ -0,0 +1,157 @@
+package bapi
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "time"
+)
+
+// BTC is the symbol Converter uses for bitcoin itself.
+const BTC = "BTC"
+
+// RateScale is the number of decimal places Quote.Rate is worked out to.
+const RateScale = 12
+
+// Basis selects the ticker price a Converter builds its rates from.
+type Basis int
+
+const (
+    BasisLast Basis = iota
+    BasisBid
+    BasisAsk
+    // BasisAverage24h only works with tickers that carry a 24h average,
+    // which the bulk GlobalTickers() ones don't.
+    BasisAverage24h
+)
+
+func (b Basis) String() string {
+    switch b {
+    case BasisLast: return "last"
+    case BasisBid: return "bid"
+    case BasisAsk: return "ask"
+    case BasisAverage24h: return "24h_avg"
+    }
+    return fmt.Sprintf("Basis(%d)", int(b))
+}
+
+func (b Basis) price(t Ticker) Decimal {
+    switch b {
+    case BasisBid: return t.Bid
+    case BasisAsk: return t.Ask
+    case BasisAverage24h: return t.Average24h
+    }
+    return t.Last
+}
+
+// UnsupportedSymbolError is returned by Converter for symbols it has no rate
+// for. It matches ErrUnknownSymbol.
+type UnsupportedSymbolError struct {
+    Symbol          string
+    Basis           Basis
+}
+
+func (e *UnsupportedSymbolError) Error() string {
+    return fmt.Sprintf("no %v rate for %v.", e.Basis, e.Symbol)
+}
+
+func (e *UnsupportedSymbolError) Is(target error) bool {
+    return target == ErrUnknownSymbol
+}
+
+// Quote is the outcome of a conversion.
+type Quote struct {
+    From            string
+    To              string
+    Amount          Decimal
+    Result          Decimal
+    // Rate is the price of one unit of From in To, to RateScale places.
+    Rate            Decimal
+    Basis           Basis
+    // Timestamp is that of the tickers snapshot the rates came from.
+    Timestamp       time.Time
+}
+
+// Converter converts amounts between BTC and the currencies of a tickers
+// snapshot, and between any two of those currencies through their implied
+// cross rate. A Converter never changes after it's built and is safe for
+// concurrent use.
+type Converter struct {
+    basis           Basis
+    timestamp       time.Time
+    // prices holds the price of one BTC in each currency.
+    prices          map[string]Decimal
+}
+
+// NewConverter builds a Converter out of all. Currencies whose price for
+// basis is missing or not positive are left out.
+func NewConverter(all *AllTickers, basis Basis) *Converter {
+    cv := &Converter{
+        basis:     basis,
+        timestamp: all.Timestamp,
+        prices:    map[string]Decimal{BTC: NewDecimal(1, 0)},
+    }
+    for symbol, t := range all.Tickers {
+        p := basis.price(t)
+        if p.Sign() > 0 { cv.prices[symbol] = p }
+    }
+    return cv
+}
+
+// LoadConverter builds a Converter out of the current global tickers.
+func LoadConverter(ctx context.Context, c Client, basis Basis) (*Converter, error) {
+    all, err := c.GlobalTickersContext(ctx)
+    if err != nil { return nil, err }
+    return NewConverter(all, basis), nil
+}
+
+func (cv *Converter) Basis() Basis {
+    return cv.basis
+}
+
+// Timestamp returns the timestamp of the snapshot the Converter was built
+// from.
+func (cv *Converter) Timestamp() time.Time {
+    return cv.timestamp
+}
+
+// Symbols returns the supported symbols, BTC included, in alphabetical
+// order.
+func (cv *Converter) Symbols() []string {
+    symbols := make([]string, 0, len(cv.prices))
+    for s := range cv.prices { symbols = append(symbols, s) }
+    sort.Strings(symbols)
+    return symbols
+}
+
+func (cv *Converter) pair(from, to string) (Decimal, Decimal, error) {
+    pf, ok := cv.prices[from]
+    if !ok { return Decimal{}, Decimal{}, &UnsupportedSymbolError{Symbol: from, Basis: cv.basis} }
+    pt, ok := cv.prices[to]
+    if !ok { return Decimal{}, Decimal{}, &UnsupportedSymbolError{Symbol: to, Basis: cv.basis} }
+    return pf, pt, nil
+}
+
+// Rate returns the price of one unit of from in to, to scale places.
+func (cv *Converter) Rate(from, to string, scale int32) (Decimal, error) {
+    pf, pt, err := cv.pair(from, to)
+    if err != nil { return Decimal{}, err }
+    return pt.Quo(pf, scale, RoundHalfEven), nil
+}
+
+// Convert converts amount from one symbol to another. The result is rounded
+// half-even to scale places, in a single step, so going through the BTC
+// cross rate doesn't compound any rounding.
+func (cv *Converter) Convert(amount Decimal, from, to string, scale int32) (*Quote, error) {
+    pf, pt, err := cv.pair(from, to)
+    if err != nil { return nil, err }
+    return &Quote{
+        From:      from,
+        To:        to,
+        Amount:    amount,
+        Result:    amount.Mul(pt).Quo(pf, scale, RoundHalfEven),
+        Rate:      pt.Quo(pf, RateScale, RoundHalfEven),
+        Basis:     cv.basis,
+        Timestamp: cv.timestamp,
+    }, nil
+}
@@ -0,0 +1,73 @@
+package bapi_test
+
+import (
+    "context"
+    "errors"
+    "reflect"
+    "testing"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func TestConverter(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    cv, err := bapi.LoadConverter(context.Background(), bapi.NewWithOptions(srv.URL), bapi.BasisLast)
+    if err != nil { t.Fatal(err) }
+
+    if got, want := cv.Symbols(), []string{"BTC", "EUR", "GBP", "USD"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("got symbols %v, want %v", got, want)
+    }
+    if want := ts("2014-11-04T14:22:03Z"); !cv.Timestamp().Equal(want) {
+        t.Errorf("got timestamp %v, want %v", cv.Timestamp(), want)
+    }
+
+    for _, c := range []struct{
+        amount, from, to string
+        scale   int32
+        want    string
+    }{
+        {"100", "EUR", "USD", 2, "125.01"},
+        {"2", "BTC", "USD", 2, "659.94"},
+        {"1000", "USD", "BTC", 8, "3.03057854"},
+        {"5", "USD", "USD", 2, "5.00"},
+    } {
+        q, err := cv.Convert(dec(c.amount), c.from, c.to, c.scale)
+        if err != nil { t.Fatal(err) }
+        if q.Result.String() != c.want {
+            t.Errorf("%v %v to %v: got %v, want %v", c.amount, c.from, c.to, q.Result, c.want)
+        }
+        if !q.Timestamp.Equal(cv.Timestamp()) || q.Basis != bapi.BasisLast {
+            t.Errorf("got %+v", q)
+        }
+    }
+
+    q, _ := cv.Convert(dec("1"), "EUR", "USD", 2)
+    if q.Rate.String() != "1.250123129381" {
+        t.Errorf("got rate %v", q.Rate)
+    }
+
+    bid := bapi.NewConverter(&bapi.AllTickers{Tickers: map[string]bapi.Ticker{
+        "EUR": {Bid: dec("263.61")},
+        "USD": {Bid: dec("329.66"), Average24h: dec("327.65")},
+    }}, bapi.BasisBid)
+    if r, err := bid.Rate("EUR", "USD", 4); err != nil || r.String() != "1.2506" {
+        t.Errorf("got %v, %v", r, err)
+    }
+
+    avg := bapi.NewConverter(&bapi.AllTickers{Tickers: map[string]bapi.Ticker{"EUR": {Last: dec("263.95")}}}, bapi.BasisAverage24h)
+    _, err = avg.Convert(dec("1"), "BTC", "EUR", 2)
+    var ue *bapi.UnsupportedSymbolError
+    if !errors.Is(err, bapi.ErrUnknownSymbol) || !errors.As(err, &ue) || ue.Symbol != "EUR" {
+        t.Errorf("got %v", err)
+    }
+}
+
+func TestBasisString(t *testing.T) {
+    for b, want := range map[bapi.Basis]string{bapi.BasisLast: "last", bapi.BasisBid: "bid", bapi.BasisAsk: "ask", bapi.BasisAverage24h: "24h_avg", bapi.Basis(9): "Basis(9)"} {
+        if got := b.String(); got != want {
+            t.Errorf("got %q, want %q", got, want)
+        }
+    }
+}
@@ -0,0 +1,327 @@
+package bapi
+
+import (
+    "database/sql/driver"
+    "math/big"
+    "strconv"
+    "strings"
+    "errors"
+    "fmt"
+)
+
+// Decimal is an arbitrary-precision decimal number, used for every price and
+// volume the API returns. Its value is unscaled * 10^-scale. The zero value
+// is 0 and ready to use. Decimals are immutable: every operation returns a
+// new value.
+type Decimal struct {
+    unscaled        *big.Int
+    scale           int32
+}
+
+// RoundingMode tells Round and Quo what to do with discarded digits.
+type RoundingMode int
+
+const (
+    // RoundHalfEven rounds to nearest, ties to even (banker's rounding).
+    RoundHalfEven RoundingMode = iota
+    // RoundHalfUp rounds to nearest, ties away from zero.
+    RoundHalfUp
+    // RoundHalfDown rounds to nearest, ties towards zero.
+    RoundHalfDown
+    // RoundDown truncates towards zero.
+    RoundDown
+    // RoundUp rounds away from zero.
+    RoundUp
+    // RoundFloor rounds towards negative infinity.
+    RoundFloor
+    // RoundCeiling rounds towards positive infinity.
+    RoundCeiling
+)
+
+var bigTen = big.NewInt(10)
+
+// NewDecimal returns unscaled * 10^-scale.
+func NewDecimal(unscaled int64, scale int32) Decimal {
+    return Decimal{unscaled: big.NewInt(unscaled), scale: scale}
+}
+
+// maxExponent bounds the exponents ParseDecimal accepts. Anything beyond it
+// has nothing to do with a price, and would have arithmetic allocate huge
+// numbers once the value is aligned with an ordinary one.
+const maxExponent = 1000
+
+// ParseDecimal parses plain ("-123.45") or scientific ("1.2345e2") notation.
+// Exponents are limited to +/- 1000.
+func ParseDecimal(s string) (Decimal, error) {
+    orig := s
+    bad := fmt.Errorf("invalid decimal %q.", orig)
+
+    var exp int64
+    if i := strings.IndexAny(s, "eE"); i >= 0 {
+        e, err := strconv.ParseInt(s[i+1:], 10, 32)
+        if err != nil || e > maxExponent || e < -maxExponent { return Decimal{}, bad }
+        exp = e
+        s = s[:i]
+    }
+
+    neg := false
+    if s != "" && (s[0] == '-' || s[0] == '+') {
+        neg = s[0] == '-'
+        s = s[1:]
+    }
+
+    intPart, fracPart := s, ""
+    if i := strings.IndexByte(s, '.'); i >= 0 {
+        intPart, fracPart = s[:i], s[i+1:]
+    }
+    digits := intPart + fracPart
+    if digits == "" { return Decimal{}, bad }
+    for _, r := range digits {
+        if r < '0' || r > '9' { return Decimal{}, bad }
+    }
+
+    scale := int64(len(fracPart)) - exp
+    if scale > 1<<31 - 1 || scale < -1<<31 { return Decimal{}, bad }
+
+    v, _ := new(big.Int).SetString(digits, 10)
+    if neg { v.Neg(v) }
+    return Decimal{unscaled: v, scale: int32(scale)}, nil
+}
+
+// MustParseDecimal is like ParseDecimal but panics on malformed input. It is
+// meant for constants.
+func MustParseDecimal(s string) Decimal {
+    d, err := ParseDecimal(s)
+    if err != nil { panic(err) }
+    return d
+}
+
+// decimalField parses numeric CSV and JSON fields. The API leaves fields
+// blank to mean "not available", and those come out as the zero Decimal on
+// purpose: it never sends a real zero price, so callers treat zero as
+// missing. Anything else goes through ParseDecimal.
+func decimalField(s string) (Decimal, error) {
+    if s == "" { return Decimal{}, nil }
+    return ParseDecimal(s)
+}
+
+func (d Decimal) int() *big.Int {
+    if d.unscaled == nil { return new(big.Int) }
+    return d.unscaled
+}
+
+func pow10(n int32) *big.Int {
+    return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// rescale returns the unscaled value of d at a larger scale.
+func (d Decimal) rescale(scale int32) *big.Int {
+    if scale == d.scale { return d.int() }
+    return new(big.Int).Mul(d.int(), pow10(scale - d.scale))
+}
+
+func align(a, b Decimal) (*big.Int, *big.Int, int32) {
+    scale := a.scale
+    if b.scale > scale { scale = b.scale }
+    return a.rescale(scale), b.rescale(scale), scale
+}
+
+// Scale returns the number of digits after the decimal point.
+func (d Decimal) Scale() int32 {
+    return d.scale
+}
+
+func (d Decimal) Add(d2 Decimal) Decimal {
+    a, b, scale := align(d, d2)
+    return Decimal{unscaled: new(big.Int).Add(a, b), scale: scale}
+}
+
+func (d Decimal) Sub(d2 Decimal) Decimal {
+    a, b, scale := align(d, d2)
+    return Decimal{unscaled: new(big.Int).Sub(a, b), scale: scale}
+}
+
+func (d Decimal) Mul(d2 Decimal) Decimal {
+    return Decimal{unscaled: new(big.Int).Mul(d.int(), d2.int()), scale: d.scale + d2.scale}
+}
+
+// Quo returns d / d2 rounded to scale digits after the decimal point. It
+// panics if d2 is zero.
+func (d Decimal) Quo(d2 Decimal, scale int32, mode RoundingMode) Decimal {
+    if d2.IsZero() { panic("bapi: decimal division by zero") }
+
+    num := new(big.Int).Set(d.int())
+    den := new(big.Int).Set(d2.int())
+    if e := scale + d2.scale - d.scale; e >= 0 {
+        num.Mul(num, pow10(e))
+    } else {
+        den.Mul(den, pow10(-e))
+    }
+    return Decimal{unscaled: roundQuo(num, den, mode), scale: scale}
+}
+
+// PercentScale is the number of decimal places PercentOf works out to.
+const PercentScale = 4
+
+var hundred = NewDecimal(100, 0)
+
+// PercentOf returns d as a percentage of whole, rounded half to even to
+// PercentScale places. It panics if whole is zero.
+func (d Decimal) PercentOf(whole Decimal) Decimal {
+    return d.Mul(hundred).Quo(whole, PercentScale, RoundHalfEven)
+}
+
+// Round returns d rounded to scale digits after the decimal point.
+func (d Decimal) Round(scale int32, mode RoundingMode) Decimal {
+    if scale >= d.scale {
+        return Decimal{unscaled: d.rescale(scale), scale: scale}
+    }
+    return Decimal{unscaled: roundQuo(d.int(), pow10(d.scale - scale), mode), scale: scale}
+}
+
+// roundQuo divides num by den, rounding as per mode.
+func roundQuo(num, den *big.Int, mode RoundingMode) *big.Int {
+    q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+    if r.Sign() == 0 { return q }
+
+    neg := (num.Sign() < 0) != (den.Sign() < 0)
+    half := new(big.Int).Abs(r)
+    half.Lsh(half, 1)
+    cmpHalf := half.Cmp(new(big.Int).Abs(den))
+
+    var away bool
+    switch mode {
+    case RoundHalfEven: away = cmpHalf > 0 || (cmpHalf == 0 && q.Bit(0) == 1)
+    case RoundHalfUp: away = cmpHalf >= 0
+    case RoundHalfDown: away = cmpHalf > 0
+    case RoundDown: away = false
+    case RoundUp: away = true
+    case RoundFloor: away = neg
+    case RoundCeiling: away = !neg
+    }
+
+    if away {
+        if neg {
+            q.Sub(q, big.NewInt(1))
+        } else {
+            q.Add(q, big.NewInt(1))
+        }
+    }
+    return q
+}
+
+func (d Decimal) Neg() Decimal {
+    return Decimal{unscaled: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+func (d Decimal) Abs() Decimal {
+    return Decimal{unscaled: new(big.Int).Abs(d.int()), scale: d.scale}
+}
+
+// Sign returns -1, 0 or +1.
+func (d Decimal) Sign() int {
+    return d.int().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+    return d.Sign() == 0
+}
+
+// Cmp returns -1, 0 or +1 depending on whether d is less than, equal to or
+// greater than d2.
+func (d Decimal) Cmp(d2 Decimal) int {
+    a, b, _ := align(d, d2)
+    return a.Cmp(b)
+}
+
+// Equal compares values, regardless of scale: 1.50 equals 1.5.
+func (d Decimal) Equal(d2 Decimal) bool {
+    return d.Cmp(d2) == 0
+}
+
+// Float64 returns the nearest float64. Precision may be lost.
+func (d Decimal) Float64() float64 {
+    f, _ := strconv.ParseFloat(d.String(), 64)
+    return f
+}
+
+// String formats d in plain notation, keeping trailing zeros.
+func (d Decimal) String() string {
+    v := d.int()
+    digits := new(big.Int).Abs(v).String()
+    sign := ""
+    if v.Sign() < 0 { sign = "-" }
+
+    if d.scale <= 0 {
+        if v.Sign() == 0 { return "0" }
+        return sign + digits + strings.Repeat("0", int(-d.scale))
+    }
+
+    scale := int(d.scale)
+    if len(digits) <= scale {
+        digits = strings.Repeat("0", scale - len(digits) + 1) + digits
+    }
+    point := len(digits) - scale
+    return sign + digits[:point] + "." + digits[point:]
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+    return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts JSON numbers, numeric strings, and null and blank
+// strings, which decode as zero (see decimalField).
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+    s := string(data)
+    if s == "null" {
+        *d = Decimal{}
+        return nil
+    }
+    if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+        s = s[1:len(s)-1]
+    }
+
+    v, err := decimalField(s)
+    if err != nil { return err }
+    *d = v
+    return nil
+}
+
+func (d Decimal) MarshalText() ([]byte, error) {
+    return []byte(d.String()), nil
+}
+
+// UnmarshalText, unlike UnmarshalJSON, rejects blank input: text has no
+// upstream convention behind it.
+func (d *Decimal) UnmarshalText(text []byte) error {
+    v, err := ParseDecimal(string(text))
+    if err != nil { return err }
+    *d = v
+    return nil
+}
+
+// Value implements driver.Valuer. Decimals are stored as strings so that
+// NUMERIC columns get them without loss.
+func (d Decimal) Value() (driver.Value, error) {
+    return d.String(), nil
+}
+
+// Scan implements sql.Scanner.
+func (d *Decimal) Scan(src interface{}) error {
+    var err error
+    switch v := src.(type) {
+    case nil:
+        *d = Decimal{}
+    case []byte:
+        *d, err = ParseDecimal(string(v))
+    case string:
+        *d, err = ParseDecimal(v)
+    case int64:
+        *d = NewDecimal(v, 0)
+    case float64:
+        *d, err = ParseDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+    default:
+        err = errors.New("unsupported type for Decimal.")
+    }
+    return err
+}
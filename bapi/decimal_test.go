@@ -0,0 +1,154 @@
+package bapi_test
+
+import (
+    "encoding/json"
+    "strings"
+    "testing"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+func TestParseDecimal(t *testing.T) {
+    tests := []struct {
+        in      string
+        want    string
+        scale   int32
+    }{
+        {"0", "0", 0},
+        {"329.97", "329.97", 2},
+        {"-0.005", "-0.005", 3},
+        {"+7.", "7", 0},
+        {".5", "0.5", 1},
+        {"1e3", "1000", -3},
+        {"1.5E-3", "0.0015", 4},
+        {"48203.110", "48203.110", 3},
+        {"1e-1000", "0." + strings.Repeat("0", 999) + "1", 1000},
+    }
+    for _, tt := range tests {
+        d, err := bapi.ParseDecimal(tt.in)
+        if err != nil {
+            t.Errorf("%q: %v", tt.in, err)
+            continue
+        }
+        if d.String() != tt.want || d.Scale() != tt.scale {
+            t.Errorf("%q: got %v (scale %v), want %v (scale %v)", tt.in, d, d.Scale(), tt.want, tt.scale)
+        }
+    }
+
+    for _, in := range []string{"", "-", ".", "abc", "1.2.3", "1e", "0x10", "1,5", "1e1001", "1e-1001", "1e999999999"} {
+        if _, err := bapi.ParseDecimal(in); err == nil {
+            t.Errorf("%q: expected an error", in)
+        }
+    }
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+    a, b := dec("329.97"), dec("-0.125")
+
+    tests := []struct {
+        name    string
+        got     bapi.Decimal
+        want    string
+    }{
+        {"Add", a.Add(b), "329.845"},
+        {"Sub", a.Sub(b), "330.095"},
+        {"Mul", a.Mul(b), "-41.24625"},
+        {"Quo", a.Quo(dec("3"), 4, bapi.RoundHalfEven), "109.9900"},
+        {"Quo repeating", dec("1").Quo(dec("3"), 8, bapi.RoundHalfEven), "0.33333333"},
+        {"Quo negative scale", dec("10").Quo(dec("0.04"), 2, bapi.RoundHalfEven), "250.00"},
+        {"PercentOf", b.PercentOf(dec("3")), "-4.1667"},
+        {"Neg", b.Neg(), "0.125"},
+        {"Abs", b.Abs(), "0.125"},
+        {"zero value", bapi.Decimal{}.Add(a), "329.97"},
+    }
+    for _, tt := range tests {
+        if tt.got.String() != tt.want {
+            t.Errorf("%v: got %v, want %v", tt.name, tt.got, tt.want)
+        }
+    }
+
+    if a.Cmp(b) != 1 || b.Cmp(a) != -1 || !dec("1.50").Equal(dec("1.5")) {
+        t.Error("Cmp is broken")
+    }
+    if b.Sign() != -1 || !(bapi.Decimal{}).IsZero() {
+        t.Error("Sign is broken")
+    }
+}
+
+func TestDecimalRound(t *testing.T) {
+    inputs := []string{"2.5", "-2.5", "3.5", "2.51", "-2.49"}
+    tests := []struct {
+        mode    bapi.RoundingMode
+        want    []string
+    }{
+        {bapi.RoundHalfEven, []string{"2", "-2", "4", "3", "-2"}},
+        {bapi.RoundHalfUp, []string{"3", "-3", "4", "3", "-2"}},
+        {bapi.RoundHalfDown, []string{"2", "-2", "3", "3", "-2"}},
+        {bapi.RoundDown, []string{"2", "-2", "3", "2", "-2"}},
+        {bapi.RoundUp, []string{"3", "-3", "4", "3", "-3"}},
+        {bapi.RoundFloor, []string{"2", "-3", "3", "2", "-3"}},
+        {bapi.RoundCeiling, []string{"3", "-2", "4", "3", "-2"}},
+    }
+    for _, tt := range tests {
+        for i, in := range inputs {
+            if got := dec(in).Round(0, tt.mode).String(); got != tt.want[i] {
+                t.Errorf("mode %v, %v: got %v, want %v", tt.mode, in, got, tt.want[i])
+            }
+        }
+    }
+
+    if got := dec("1.5").Round(3, bapi.RoundDown).String(); got != "1.500" {
+        t.Errorf("widening: got %v", got)
+    }
+}
+
+func TestDecimalMarshaling(t *testing.T) {
+    var v struct {
+        A   bapi.Decimal     `json:"a"`
+        B   bapi.Decimal     `json:"b"`
+        C   bapi.Decimal     `json:"c"`
+    }
+    err := json.Unmarshal([]byte(`{"a": 329.97, "b": "1e-2", "c": null}`), &v)
+    if err != nil { t.Fatal(err) }
+    if v.A.String() != "329.97" || v.B.String() != "0.01" || !v.C.IsZero() {
+        t.Errorf("unexpected values: %+v", v)
+    }
+
+    // Upstream leaves unavailable values blank.
+    d := dec("1")
+    if err := json.Unmarshal([]byte(`""`), &d); err != nil || !d.IsZero() {
+        t.Errorf("blank string: got %v, %v", d, err)
+    }
+    if err := d.UnmarshalText([]byte("")); err == nil {
+        t.Error("UnmarshalText accepted blank input")
+    }
+    if err := d.UnmarshalText([]byte("1e5000")); err == nil {
+        t.Error("UnmarshalText accepted a huge exponent")
+    }
+
+    out, err := json.Marshal(v)
+    if err != nil { t.Fatal(err) }
+    if string(out) != `{"a":329.97,"b":0.01,"c":0}` {
+        t.Errorf("got %s", out)
+    }
+
+    scans := []struct {
+        src     interface{}
+        want    string
+    }{
+        {[]byte("12.50"), "12.50"},
+        {"12.50", "12.50"},
+        {int64(12), "12"},
+        {12.5, "12.5"},
+        {nil, "0"},
+    }
+    for _, tt := range scans {
+        var d bapi.Decimal
+        if err := d.Scan(tt.src); err != nil || d.String() != tt.want {
+            t.Errorf("Scan(%#v): got %v, %v", tt.src, d, err)
+        }
+    }
+    if v, _ := dec("12.50").Value(); v != "12.50" {
+        t.Errorf("Value: got %#v", v)
+    }
+}
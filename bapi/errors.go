@@ -0,0 +1,101 @@
+package bapi
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+    "errors"
+    "time"
+    "fmt"
+)
+
+var (
+    // ErrUnknownSymbol matches API errors caused by asking for a symbol (or
+    // endpoint) the index knows nothing about.
+    ErrUnknownSymbol = errors.New("unknown symbol.")
+    // ErrRateLimited matches API errors caused by exceeding the request quota.
+    ErrRateLimited = errors.New("rate limited.")
+    // ErrServerUnavailable matches API errors caused by the index being down
+    // or otherwise unable to serve the request.
+    ErrServerUnavailable = errors.New("server unavailable.")
+)
+
+// APIError is returned whenever the API answers with a non-200 status code.
+// Use errors.Is with ErrUnknownSymbol, ErrRateLimited or ErrServerUnavailable
+// to branch on the broad cause, or errors.As to get at the details.
+type APIError struct {
+    StatusCode      int
+    Endpoint        string
+    Header          http.Header
+    Body            []byte
+    // RetryAfter is zero unless the server sent a Retry-After header.
+    RetryAfter      time.Duration
+    // Message is the server's explanation, extracted from Body.
+    Message         string
+}
+
+func newAPIError(endpoint string, resp *http.Response, body []byte) *APIError {
+    return &APIError{
+        StatusCode: resp.StatusCode,
+        Endpoint:   endpoint,
+        Header:     resp.Header,
+        Body:       body,
+        RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+        Message:    parseErrorMessage(resp.StatusCode, body),
+    }
+}
+
+func (e *APIError) Error() string {
+    return fmt.Sprintf("%v: %v %v", e.Endpoint, e.StatusCode, e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+    switch target {
+    case ErrUnknownSymbol:
+        return e.StatusCode == http.StatusNotFound
+    case ErrRateLimited:
+        return e.StatusCode == http.StatusTooManyRequests
+    case ErrServerUnavailable:
+        return e.StatusCode >= 500
+    }
+    return false
+}
+
+// parseErrorMessage digs a human readable message out of an error response.
+// The API isn't consistent about it, so try the usual JSON shapes before
+// settling for the raw body.
+func parseErrorMessage(status int, body []byte) string {
+    var m map[string]interface{}
+    if json.Unmarshal(body, &m) == nil {
+        for _, k := range []string{"message", "error", "detail"} {
+            if s, ok := m[k].(string); ok && s != "" {
+                return s
+            }
+        }
+    }
+
+    msg := strings.TrimSpace(string(body))
+    if msg == "" || strings.HasPrefix(msg, "<") {
+        msg = http.StatusText(status)
+    }
+    return msg
+}
+
+// parseRetryAfter understands both forms of the Retry-After header: delay in
+// seconds and HTTP date.
+func parseRetryAfter(v string) time.Duration {
+    if v == "" { return 0 }
+
+    if secs, err := strconv.Atoi(v); err == nil {
+        if secs < 0 { return 0 }
+        return time.Duration(secs) * time.Second
+    }
+
+    if t, err := http.ParseTime(v); err == nil {
+        if d := time.Until(t); d > 0 {
+            return d
+        }
+    }
+    return 0
+}
@@ -0,0 +1,33 @@
+package bapi
+
+import (
+    "time"
+)
+
+// The tests live in package bapi_test, so that they can use bapitest. These
+// let them get at the internals they check.
+
+var Classify = classify
+
+func (p *RetryPolicy) Backoff(attempt int, err error) time.Duration {
+    return p.backoff(attempt, err)
+}
+
+func (l *RateLimiter) Throttle(class EndpointClass) { l.throttle(class) }
+func (l *RateLimiter) Recover(class EndpointClass) { l.recover(class) }
+
+// Bucket returns the current rate and tokens of class.
+func (l *RateLimiter) Bucket(class EndpointClass) (rate, tokens float64) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    b := l.buckets[class]
+    return b.rate, b.tokens
+}
+
+func (w *Watcher) Next(latest, now time.Time) time.Duration {
+    return w.next(latest, now)
+}
+
+func (dc *DiskCache) Path(key string) string {
+    return dc.path(key)
+}
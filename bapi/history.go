@@ -0,0 +1,215 @@
+package bapi
+
+import (
+    "context"
+    "errors"
+    "time"
+)
+
+// TimeRange selects records with From <= DateTime < To. A zero From or To
+// leaves that end open.
+type TimeRange struct {
+    From            time.Time
+    To              time.Time
+}
+
+func (tr TimeRange) Contains(t time.Time) bool {
+    if !tr.From.IsZero() && t.Before(tr.From) { return false }
+    if !tr.To.IsZero() && !t.Before(tr.To) { return false }
+    return true
+}
+
+// key identifies tr among the arguments of coalesced calls.
+func (tr TimeRange) key() string {
+    return tr.From.UTC().Format(time.RFC3339Nano) + "/" + tr.To.UTC().Format(time.RFC3339Nano)
+}
+
+// past tells whether t is beyond the end of the range, so that streaming
+// chronologically ordered records can stop.
+func (tr TimeRange) past(t time.Time) bool {
+    return !tr.To.IsZero() && !t.Before(tr.To)
+}
+
+// Resolution is the time between records of a history series.
+type Resolution int
+
+const (
+    // ResolutionAuto lets History pick the finest resolution available.
+    ResolutionAuto Resolution = iota
+    ResolutionMinute
+    ResolutionHour
+    ResolutionDay
+)
+
+func (r Resolution) String() string {
+    switch r {
+    case ResolutionMinute: return "minute"
+    case ResolutionHour: return "hour"
+    case ResolutionDay: return "day"
+    }
+    return "auto"
+}
+
+// Duration returns the time between records, or zero for ResolutionAuto.
+func (r Resolution) Duration() time.Duration {
+    switch r {
+    case ResolutionMinute: return time.Minute
+    case ResolutionHour: return time.Hour
+    case ResolutionDay: return 24 * time.Hour
+    }
+    return 0
+}
+
+// window is how far back each history endpoint goes. Zero means all time.
+func (r Resolution) window() time.Duration {
+    switch r {
+    case ResolutionMinute: return 24 * time.Hour
+    case ResolutionHour: return 30 * 24 * time.Hour
+    }
+    return 0
+}
+
+// ErrRangeNotCovered is returned by History when no endpoint at or above
+// the requested resolution has data for the range: it starts after now, or
+// the resolution is coarser than daily. The daily endpoint goes back to the
+// start of the index, so any range from the past is covered by it.
+var ErrRangeNotCovered = errors.New("no history endpoint covers the requested range.")
+
+// HistoryRecord is the common denominator of the history record types. Fields
+// an endpoint doesn't provide are zero: High and Low for minutely records,
+// Volume for all but daily ones.
+type HistoryRecord struct {
+    DateTime        time.Time
+    High            Decimal
+    Low             Decimal
+    Average         Decimal
+    Volume          Decimal
+}
+
+func (r MinutelyHistoryRecord) HistoryRecord() HistoryRecord {
+    return HistoryRecord{DateTime: r.DateTime, Average: r.Average}
+}
+
+func (r HourlyHistoryRecord) HistoryRecord() HistoryRecord {
+    return HistoryRecord{DateTime: r.DateTime, High: r.High, Low: r.Low, Average: r.Average}
+}
+
+func (r DailyHistoryRecord) HistoryRecord() HistoryRecord {
+    return HistoryRecord{DateTime: r.DateTime, High: r.High, Low: r.Low, Average: r.Average, Volume: r.Volume}
+}
+
+// MinutelyHistoryRange returns the minutely records within tr. Records are
+// served in chronological order, so streaming stops as soon as the range is
+// left behind.
+func (c *ApiClient) MinutelyHistoryRange(symbol string, tr TimeRange) ([]MinutelyHistoryRecord, error) {
+    return c.MinutelyHistoryRangeContext(context.Background(), symbol, tr)
+}
+
+func (c *ApiClient) MinutelyHistoryRangeContext(ctx context.Context, symbol string, tr TimeRange) ([]MinutelyHistoryRecord, error) {
+    v, err := c.shared(ctx, "MinutelyHistoryRange/" + symbol + "/" + tr.key(), func(ctx context.Context) (interface{}, error) {
+        rs := make([]MinutelyHistoryRecord, 0)
+        err := c.MinutelyHistoryEach(ctx, symbol, func(r MinutelyHistoryRecord) error {
+            if tr.past(r.DateTime) { return StopIteration }
+            if tr.Contains(r.DateTime) { rs = append(rs, r) }
+            return nil
+        })
+        if err != nil { return nil, err }
+
+        return rs, nil
+    })
+    if err != nil { return nil, err }
+    return v.([]MinutelyHistoryRecord), nil
+}
+
+// HourlyHistoryRange is like MinutelyHistoryRange, for hourly records.
+func (c *ApiClient) HourlyHistoryRange(symbol string, tr TimeRange) ([]HourlyHistoryRecord, error) {
+    return c.HourlyHistoryRangeContext(context.Background(), symbol, tr)
+}
+
+func (c *ApiClient) HourlyHistoryRangeContext(ctx context.Context, symbol string, tr TimeRange) ([]HourlyHistoryRecord, error) {
+    v, err := c.shared(ctx, "HourlyHistoryRange/" + symbol + "/" + tr.key(), func(ctx context.Context) (interface{}, error) {
+        rs := make([]HourlyHistoryRecord, 0)
+        err := c.HourlyHistoryEach(ctx, symbol, func(r HourlyHistoryRecord) error {
+            if tr.past(r.DateTime) { return StopIteration }
+            if tr.Contains(r.DateTime) { rs = append(rs, r) }
+            return nil
+        })
+        if err != nil { return nil, err }
+
+        return rs, nil
+    })
+    if err != nil { return nil, err }
+    return v.([]HourlyHistoryRecord), nil
+}
+
+// DailyHistoryRange is like MinutelyHistoryRange, for daily records.
+func (c *ApiClient) DailyHistoryRange(symbol string, tr TimeRange) ([]DailyHistoryRecord, error) {
+    return c.DailyHistoryRangeContext(context.Background(), symbol, tr)
+}
+
+func (c *ApiClient) DailyHistoryRangeContext(ctx context.Context, symbol string, tr TimeRange) ([]DailyHistoryRecord, error) {
+    v, err := c.shared(ctx, "DailyHistoryRange/" + symbol + "/" + tr.key(), func(ctx context.Context) (interface{}, error) {
+        rs := make([]DailyHistoryRecord, 0)
+        err := c.DailyHistoryEach(ctx, symbol, func(r DailyHistoryRecord) error {
+            if tr.past(r.DateTime) { return StopIteration }
+            if tr.Contains(r.DateTime) { rs = append(rs, r) }
+            return nil
+        })
+        if err != nil { return nil, err }
+
+        return rs, nil
+    })
+    if err != nil { return nil, err }
+    return v.([]DailyHistoryRecord), nil
+}
+
+// History returns the records of symbol within tr from the finest endpoint,
+// no finer than res, whose window reaches back to tr.From. An open-ended
+// From needs the all-time daily history.
+func (c *ApiClient) History(symbol string, res Resolution, tr TimeRange) ([]HistoryRecord, Resolution, error) {
+    return c.HistoryContext(context.Background(), symbol, res, tr)
+}
+
+func (c *ApiClient) HistoryContext(ctx context.Context, symbol string, res Resolution, tr TimeRange) ([]HistoryRecord, Resolution, error) {
+    // Check coverage before settling on an endpoint: every range ends up
+    // with the daily one otherwise.
+    now := time.Now()
+    if res > ResolutionDay || (!tr.From.IsZero() && tr.From.After(now)) {
+        return nil, ResolutionAuto, ErrRangeNotCovered
+    }
+
+    if res == ResolutionAuto { res = ResolutionMinute }
+    for ; res < ResolutionDay; res++ {
+        if !tr.From.IsZero() && !tr.From.Before(now.Add(-res.window())) { break }
+    }
+
+    v, err := c.shared(ctx, "History/" + res.String() + "/" + symbol + "/" + tr.key(), func(ctx context.Context) (interface{}, error) {
+        rs := make([]HistoryRecord, 0)
+        var err error
+        switch res {
+        case ResolutionMinute:
+            err = c.MinutelyHistoryEach(ctx, symbol, func(r MinutelyHistoryRecord) error {
+                return collectRange(&rs, tr, r.HistoryRecord())
+            })
+        case ResolutionHour:
+            err = c.HourlyHistoryEach(ctx, symbol, func(r HourlyHistoryRecord) error {
+                return collectRange(&rs, tr, r.HistoryRecord())
+            })
+        default:
+            err = c.DailyHistoryEach(ctx, symbol, func(r DailyHistoryRecord) error {
+                return collectRange(&rs, tr, r.HistoryRecord())
+            })
+        }
+        if err != nil { return nil, err }
+
+        return rs, nil
+    })
+    if err != nil { return nil, res, err }
+    return v.([]HistoryRecord), res, nil
+}
+
+func collectRange(rs *[]HistoryRecord, tr TimeRange, r HistoryRecord) error {
+    if tr.past(r.DateTime) { return StopIteration }
+    if tr.Contains(r.DateTime) { *rs = append(*rs, r) }
+    return nil
+}
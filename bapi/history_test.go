@@ -0,0 +1,82 @@
+package bapi_test
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func TestHistoryRange(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+    ctx := context.Background()
+
+    tr := bapi.TimeRange{
+        From: time.Date(2014, 11, 4, 14, 20, 0, 0, time.UTC),
+        To:   time.Date(2014, 11, 4, 14, 21, 0, 0, time.UTC),
+    }
+    rs, err := c.MinutelyHistoryRange("USD", tr)
+    if err != nil { t.Fatal(err) }
+    if len(rs) != 1 || !rs[0].Average.Equal(dec("329.85")) {
+        t.Errorf("got %+v", rs)
+    }
+
+    hrs, err := c.HourlyHistoryRangeContext(ctx, "USD", bapi.TimeRange{To: time.Date(2014, 11, 4, 13, 0, 0, 0, time.UTC)})
+    if err != nil { t.Fatal(err) }
+    if len(hrs) != 4 || !hrs[3].Average.Equal(dec("328.13")) {
+        t.Errorf("got %+v", hrs)
+    }
+}
+
+func TestHistoryPicksEndpoint(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+    ctx := context.Background()
+
+    // The fixtures are from 2014, well beyond the minutely and hourly
+    // windows, so only the daily history covers them.
+    tr := bapi.TimeRange{From: time.Date(2014, 11, 3, 0, 0, 0, 0, time.UTC)}
+    rs, res, err := c.HistoryContext(ctx, "USD", bapi.ResolutionAuto, tr)
+    if err != nil { t.Fatal(err) }
+    if res != bapi.ResolutionDay || len(rs) != 1 || !rs[0].Volume.Equal(dec("44810.68")) {
+        t.Errorf("got %v records at resolution %v: %+v", len(rs), res, rs)
+    }
+
+    // A recent range can be served by the minutely endpoint.
+    _, res, err = c.HistoryContext(ctx, "USD", bapi.ResolutionAuto, bapi.TimeRange{From: time.Now().Add(-time.Hour)})
+    if err != nil { t.Fatal(err) }
+    if res != bapi.ResolutionMinute {
+        t.Errorf("got resolution %v, want minute", res)
+    }
+
+    // Unless asked for something coarser.
+    _, res, err = c.HistoryContext(ctx, "USD", bapi.ResolutionHour, bapi.TimeRange{From: time.Now().Add(-time.Hour)})
+    if err != nil { t.Fatal(err) }
+    if res != bapi.ResolutionHour {
+        t.Errorf("got resolution %v, want hour", res)
+    }
+
+    // Nothing has data past now, or coarser than daily.
+    for _, tt := range []struct{
+        res     bapi.Resolution
+        tr      bapi.TimeRange
+    }{
+        {bapi.ResolutionAuto, bapi.TimeRange{From: time.Now().Add(time.Hour)}},
+        {bapi.ResolutionDay, bapi.TimeRange{From: time.Now().Add(time.Hour), To: time.Now().Add(2 * time.Hour)}},
+        {bapi.ResolutionDay + 1, bapi.TimeRange{}},
+    } {
+        n := len(srv.Requests())
+        if _, _, err = c.HistoryContext(ctx, "USD", tt.res, tt.tr); !errors.Is(err, bapi.ErrRangeNotCovered) {
+            t.Errorf("%v %+v: got %v, want ErrRangeNotCovered", tt.res, tt.tr, err)
+        }
+        if len(srv.Requests()) != n {
+            t.Errorf("%v %+v: sent a request for an uncovered range", tt.res, tt.tr)
+        }
+    }
+}
@@ -0,0 +1,55 @@
+package bapi
+
+import (
+    "sort"
+    "strconv"
+)
+
+// madFloor is the smallest MAD, relative to the median, MedianMAD returns.
+var madFloor = NewDecimal(1, 4)
+
+// MedianMAD returns the weighted median of values and the weighted median of
+// their absolute deviations from it, the MAD. A weighted median is the
+// smallest value at which the cumulative weight reaches half the total. The
+// MAD is taken to be at least 0.01% of the median, so that a lone outlier
+// among identical values still stands out.
+//
+// A nil weights weighs every value the same. Otherwise there must be one
+// positive weight per value. values must not be empty.
+func MedianMAD(values, weights []Decimal) (median, mad Decimal) {
+    vs := make([]weighted, len(values))
+    for i, v := range values {
+        vs[i] = weighted{v, NewDecimal(1, 0)}
+        if weights != nil { vs[i].weight = weights[i] }
+    }
+    median = weightedMedian(vs)
+
+    for i := range vs { vs[i].value = vs[i].value.Sub(median).Abs() }
+    mad = weightedMedian(vs)
+    if min := median.Mul(madFloor); mad.Cmp(min) < 0 { mad = min }
+    return median, mad
+}
+
+// BeyondMADs tells whether v is more than mads MADs away from median. The
+// comparison is exact, mads being converted to its shortest decimal form.
+func BeyondMADs(v, median, mad Decimal, mads float64) bool {
+    limit, err := ParseDecimal(strconv.FormatFloat(mads, 'f', -1, 64))
+    if err != nil { return false }
+    return v.Sub(median).Abs().Cmp(mad.Mul(limit)) > 0
+}
+
+type weighted struct {
+    value           Decimal
+    weight          Decimal
+}
+
+func weightedMedian(vs []weighted) Decimal {
+    sort.SliceStable(vs, func(i, j int) bool { return vs[i].value.Cmp(vs[j].value) < 0 })
+    var total, cum Decimal
+    for _, v := range vs { total = total.Add(v.weight) }
+    for _, v := range vs {
+        cum = cum.Add(v.weight)
+        if cum.Add(cum).Cmp(total) >= 0 { return v.value }
+    }
+    return vs[len(vs)-1].value
+}
@@ -0,0 +1,33 @@
+package bapi_test
+
+import (
+    "testing"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+func TestMedianMAD(t *testing.T) {
+    dec := bapi.MustParseDecimal
+    prices := []bapi.Decimal{dec("101"), dec("99"), dec("100"), dec("130"), dec("102")}
+
+    med, mad := bapi.MedianMAD(prices, nil)
+    if med.String() != "101" || mad.String() != "1" {
+        t.Errorf("got median %v, MAD %v, want 101, 1", med, mad)
+    }
+    if !bapi.BeyondMADs(dec("130"), med, mad, 5) || bapi.BeyondMADs(dec("106"), med, mad, 5) {
+        t.Error("BeyondMADs is broken")
+    }
+
+    // The heavy one pulls the median its way.
+    weights := []bapi.Decimal{dec("1"), dec("1"), dec("10"), dec("1"), dec("1")}
+    if med, _ = bapi.MedianMAD(prices, weights); med.String() != "100" {
+        t.Errorf("got weighted median %v, want 100", med)
+    }
+
+    // Identical prices have no MAD to speak of: it's floored at 0.01% of
+    // the median.
+    med, mad = bapi.MedianMAD([]bapi.Decimal{dec("200"), dec("200"), dec("200")}, nil)
+    if !mad.Equal(dec("0.02")) || !bapi.BeyondMADs(dec("200.2"), med, mad, 5) {
+        t.Errorf("got MAD %v, want 0.02", mad)
+    }
+}
@@ -0,0 +1,72 @@
+package bapi
+
+import (
+    "net/http"
+)
+
+// Option configures an ApiClient. See New and NewWithOptions.
+type Option func(*ApiClient)
+
+// Middleware wraps the RoundTripper used for every request made by an
+// ApiClient. Middleware is applied in the order given, the first one being
+// the outermost.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts an ordinary function to the http.RoundTripper
+// interface, which comes in handy when writing Middleware.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+    return f(req)
+}
+
+// WithHTTPClient makes the ApiClient issue its requests through hc instead of
+// http.DefaultClient. The given client is never modified.
+func WithHTTPClient(hc *http.Client) Option {
+    return func(c *ApiClient) {
+        c.client = hc
+    }
+}
+
+// WithTransport overrides the transport of the underlying http.Client.
+func WithTransport(rt http.RoundTripper) Option {
+    return func(c *ApiClient) {
+        c.transport = rt
+    }
+}
+
+// WithHeader adds a header to be sent along with every request.
+func WithHeader(key, value string) Option {
+    return func(c *ApiClient) {
+        c.headers.Add(key, value)
+    }
+}
+
+// WithMiddleware appends mw to the client's middleware chain.
+func WithMiddleware(mw ...Middleware) Option {
+    return func(c *ApiClient) {
+        c.middleware = append(c.middleware, mw...)
+    }
+}
+
+// buildClient resolves the http.Client, transport and middleware options
+// into the http.Client actually used by apiCall.
+func (c *ApiClient) buildClient() *http.Client {
+    base := c.client
+    if base == nil { base = http.DefaultClient }
+
+    if c.transport == nil && len(c.middleware) == 0 {
+        return base
+    }
+
+    rt := c.transport
+    if rt == nil { rt = base.Transport }
+    if rt == nil { rt = http.DefaultTransport }
+    for i := len(c.middleware) - 1; i >= 0; i-- {
+        rt = c.middleware[i](rt)
+    }
+
+    hc := *base
+    hc.Transport = rt
+    return &hc
+}
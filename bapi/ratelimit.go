@@ -0,0 +1,177 @@
+package bapi
+
+import (
+    "context"
+    "strings"
+    "sync"
+    "time"
+    "fmt"
+)
+
+// EndpointClass groups API endpoints that share a request budget.
+type EndpointClass int
+
+const (
+    ClassOther EndpointClass = iota
+    ClassTickers
+    ClassExchanges
+    ClassHistory
+)
+
+func (ec EndpointClass) String() string {
+    switch ec {
+    case ClassTickers: return "tickers"
+    case ClassExchanges: return "exchanges"
+    case ClassHistory: return "history"
+    }
+    return "other"
+}
+
+func classify(endpoint string) EndpointClass {
+    switch {
+    case strings.HasPrefix(endpoint, "ticker/"): return ClassTickers
+    case strings.HasPrefix(endpoint, "exchanges/"): return ClassExchanges
+    case strings.HasPrefix(endpoint, "history/"): return ClassHistory
+    }
+    return ClassOther
+}
+
+// Budget is a token bucket: Rate tokens per second, up to Burst saved up.
+type Budget struct {
+    Rate            float64
+    Burst           int
+}
+
+// DefaultBudgets keeps well within the quotas of the public API.
+var DefaultBudgets = map[EndpointClass]Budget{
+    ClassTickers:   {Rate: 1, Burst: 5},
+    ClassExchanges: {Rate: 0.5, Burst: 3},
+    ClassHistory:   {Rate: 0.2, Burst: 2},
+    ClassOther:     {Rate: 0.5, Burst: 2},
+}
+
+// RateLimitError is returned by a fail-fast RateLimiter when the budget for
+// an endpoint class is exhausted. It matches ErrRateLimited.
+type RateLimitError struct {
+    Class           EndpointClass
+    // RetryAfter is the estimated wait until a token becomes available.
+    RetryAfter      time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+    return fmt.Sprintf("%v budget exhausted, retry in %v.", e.Class, e.RetryAfter)
+}
+
+func (e *RateLimitError) Is(target error) bool {
+    return target == ErrRateLimited
+}
+
+// RateLimiter is a client-side token bucket limiter with one bucket per
+// EndpointClass. Whenever the server answers 429 the affected bucket's rate
+// is halved, then slowly grows back to its budget as requests succeed. A
+// RateLimiter may be shared by several ApiClients.
+type RateLimiter struct {
+    // FailFast makes the limiter return a *RateLimitError instead of
+    // blocking when no token is available.
+    FailFast        bool
+
+    mu              sync.Mutex
+    buckets         map[EndpointClass]*bucket
+}
+
+type bucket struct {
+    budget          Budget
+    rate            float64
+    tokens          float64
+    last            time.Time
+}
+
+// NewRateLimiter builds a limiter with the given budgets. Classes without a
+// budget are not limited.
+func NewRateLimiter(budgets map[EndpointClass]Budget) *RateLimiter {
+    l := &RateLimiter{buckets: make(map[EndpointClass]*bucket)}
+    now := time.Now()
+    for class, b := range budgets {
+        if b.Burst < 1 { b.Burst = 1 }
+        l.buckets[class] = &bucket{budget: b, rate: b.Rate, tokens: float64(b.Burst), last: now}
+    }
+    return l
+}
+
+// WithRateLimiter makes the client take a token from l before each attempt.
+func WithRateLimiter(l *RateLimiter) Option {
+    return func(c *ApiClient) {
+        c.limiter = l
+    }
+}
+
+func (b *bucket) refill(now time.Time) {
+    b.tokens += now.Sub(b.last).Seconds() * b.rate
+    if max := float64(b.budget.Burst); b.tokens > max {
+        b.tokens = max
+    }
+    b.last = now
+}
+
+// Wait takes a token for class, blocking until one is available unless the
+// limiter is in fail-fast mode.
+func (l *RateLimiter) Wait(ctx context.Context, class EndpointClass) error {
+    for {
+        l.mu.Lock()
+        b := l.buckets[class]
+        if b == nil || b.rate <= 0 {
+            l.mu.Unlock()
+            return nil
+        }
+        b.refill(time.Now())
+        if b.tokens >= 1 {
+            b.tokens--
+            l.mu.Unlock()
+            return nil
+        }
+        wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+        l.mu.Unlock()
+
+        if l.FailFast {
+            return &RateLimitError{Class: class, RetryAfter: wait}
+        }
+
+        t := time.NewTimer(wait)
+        select {
+        case <-ctx.Done():
+            t.Stop()
+            return ctx.Err()
+        case <-t.C:
+        }
+    }
+}
+
+// throttle halves the rate of class, down to a tenth of its budget, and
+// drains its bucket.
+func (l *RateLimiter) throttle(class EndpointClass) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    b := l.buckets[class]
+    if b == nil { return }
+    b.refill(time.Now())
+    b.rate /= 2
+    if min := b.budget.Rate / 10; b.rate < min {
+        b.rate = min
+    }
+    b.tokens = 0
+}
+
+// recover grows the rate of class back towards its budget.
+func (l *RateLimiter) recover(class EndpointClass) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    b := l.buckets[class]
+    if b == nil || b.rate >= b.budget.Rate { return }
+    b.refill(time.Now())
+    b.rate += b.budget.Rate / 10
+    if b.rate > b.budget.Rate {
+        b.rate = b.budget.Rate
+    }
+}
@@ -0,0 +1,125 @@
+package bapi_test
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func TestRateLimiterFailFast(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    l := bapi.NewRateLimiter(map[bapi.EndpointClass]bapi.Budget{bapi.ClassTickers: {Rate: 0.001, Burst: 1}})
+    l.FailFast = true
+    c := bapi.NewWithOptions(srv.URL, bapi.WithRateLimiter(l))
+
+    _, err := c.GlobalTicker("USD")
+    if err != nil { t.Fatal(err) }
+
+    _, err = c.GlobalTicker("USD")
+    var rlErr *bapi.RateLimitError
+    if !errors.As(err, &rlErr) || !errors.Is(err, bapi.ErrRateLimited) || rlErr.Class != bapi.ClassTickers {
+        t.Errorf("got %v, want a *RateLimitError for tickers", err)
+    }
+
+    // Other classes have their own budget.
+    _, err = c.Exchanges("USD")
+    if err != nil { t.Error(err) }
+    if n := len(srv.Requests()); n != 2 {
+        t.Errorf("server got %v requests, want 2", n)
+    }
+}
+
+func TestClassify(t *testing.T) {
+    for endpoint, want := range map[string]bapi.EndpointClass{
+        "ticker/global/USD":                            bapi.ClassTickers,
+        "ticker/all":                                   bapi.ClassTickers,
+        "exchanges/USD":                                bapi.ClassExchanges,
+        "history/USD/per_day_all_time_history.csv":     bapi.ClassHistory,
+        "ignored":                                      bapi.ClassOther,
+    } {
+        if got := bapi.Classify(endpoint); got != want {
+            t.Errorf("%v: got %v, want %v", endpoint, got, want)
+        }
+    }
+}
+
+func TestRateLimiterWait(t *testing.T) {
+    l := bapi.NewRateLimiter(map[bapi.EndpointClass]bapi.Budget{bapi.ClassTickers: {Rate: 50, Burst: 1}})
+    ctx := context.Background()
+
+    start := time.Now()
+    for i := 0; i < 3; i++ {
+        if err := l.Wait(ctx, bapi.ClassTickers); err != nil { t.Fatal(err) }
+    }
+    // One token up front, then one every 20ms.
+    if d := time.Since(start); d < 30 * time.Millisecond {
+        t.Errorf("3 tokens took %v, want about 40ms", d)
+    }
+
+    // Unlimited classes never wait.
+    if err := l.Wait(ctx, bapi.ClassHistory); err != nil { t.Error(err) }
+
+    ctx, cancel := context.WithCancel(ctx)
+    cancel()
+    if err := l.Wait(ctx, bapi.ClassTickers); !errors.Is(err, context.Canceled) {
+        t.Errorf("got %v, want context.Canceled", err)
+    }
+}
+
+func TestRateLimiterThrottle(t *testing.T) {
+    l := bapi.NewRateLimiter(map[bapi.EndpointClass]bapi.Budget{bapi.ClassTickers: {Rate: 10, Burst: 5}})
+
+    l.Throttle(bapi.ClassTickers)
+    if rate, tokens := l.Bucket(bapi.ClassTickers); rate != 5 || tokens != 0 {
+        t.Errorf("got rate %v with %v tokens, want 5 with none", rate, tokens)
+    }
+    for i := 0; i < 10; i++ { l.Throttle(bapi.ClassTickers) }
+    if rate, _ := l.Bucket(bapi.ClassTickers); rate != 1 {
+        t.Errorf("got rate %v, want the floor of 1", rate)
+    }
+
+    l.Recover(bapi.ClassTickers)
+    if rate, _ := l.Bucket(bapi.ClassTickers); rate != 2 {
+        t.Errorf("got rate %v after recovering, want 2", rate)
+    }
+    for i := 0; i < 20; i++ { l.Recover(bapi.ClassTickers) }
+    if rate, _ := l.Bucket(bapi.ClassTickers); rate != 10 {
+        t.Errorf("got rate %v, want the budget of 10", rate)
+    }
+
+    // Unknown classes are left alone.
+    l.Throttle(bapi.ClassHistory)
+    l.Recover(bapi.ClassHistory)
+}
+
+func TestRateLimiterOn429(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    srv.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+        if r.URL.Path != "/ticker/global/USD" { return false }
+        w.WriteHeader(http.StatusTooManyRequests)
+        return true
+    })
+
+    l := bapi.NewRateLimiter(map[bapi.EndpointClass]bapi.Budget{bapi.ClassTickers: {Rate: 100, Burst: 10}})
+    c := bapi.NewWithOptions(srv.URL, bapi.WithRateLimiter(l))
+
+    if _, err := c.GlobalTicker("USD"); !errors.Is(err, bapi.ErrRateLimited) {
+        t.Fatalf("got %v, want ErrRateLimited", err)
+    }
+    if rate, _ := l.Bucket(bapi.ClassTickers); rate != 50 {
+        t.Errorf("got rate %v after a 429, want 50", rate)
+    }
+
+    if _, err := c.GlobalTickers(); err != nil { t.Fatal(err) }
+    if rate, _ := l.Bucket(bapi.ClassTickers); rate != 60 {
+        t.Errorf("got rate %v after a success, want 60", rate)
+    }
+}
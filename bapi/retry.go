@@ -0,0 +1,131 @@
+package bapi
+
+import (
+    "context"
+    "errors"
+    "math"
+    "math/rand"
+    "time"
+)
+
+// RetryPolicy controls how apiCall retries failed requests. The zero value
+// makes a single attempt, which is what clients get unless they ask for
+// something else through WithRetryPolicy.
+type RetryPolicy struct {
+    // MaxAttempts is the total number of attempts, including the first one.
+    MaxAttempts     int
+    // Backoff before attempt n+1 is InitialBackoff * Multiplier^(n-1),
+    // capped at MaxBackoff.
+    InitialBackoff  time.Duration
+    MaxBackoff      time.Duration
+    Multiplier      float64
+    // Jitter randomizes each backoff by up to +/- that fraction of it.
+    Jitter          float64
+    // RetryableStatus lists the HTTP status codes worth retrying. Transport
+    // errors are always retried.
+    RetryableStatus []int
+    // IgnoreRetryAfter makes the policy use its own backoff even when the
+    // server asks for a specific delay through Retry-After. Delays asked for
+    // by the server are capped at MaxBackoff all the same.
+    IgnoreRetryAfter bool
+    // OnAttempt, if set, is called after every attempt.
+    OnAttempt       func(Attempt)
+}
+
+// Attempt describes a single try at an endpoint, as seen by
+// RetryPolicy.OnAttempt.
+type Attempt struct {
+    Endpoint        string
+    // Number starts at 1.
+    Number          int
+    // StatusCode is zero if no response was received.
+    StatusCode      int
+    Err             error
+    Duration        time.Duration
+    // Delay is how long the client will wait before the next attempt. It is
+    // zero when this was the last one.
+    Delay           time.Duration
+}
+
+// DefaultRetryPolicy is a reasonable policy for riding out upstream blips.
+var DefaultRetryPolicy = RetryPolicy{
+    MaxAttempts:     4,
+    InitialBackoff:  500 * time.Millisecond,
+    MaxBackoff:      10 * time.Second,
+    Multiplier:      2,
+    Jitter:          0.2,
+    RetryableStatus: []int{429, 500, 502, 503, 504},
+}
+
+// WithRetryPolicy sets the policy used to retry failed requests.
+func WithRetryPolicy(p RetryPolicy) Option {
+    return func(c *ApiClient) {
+        c.retry = p
+    }
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+    // Fail-fast limiters mean it.
+    var rlErr *RateLimitError
+    if errors.As(err, &rlErr) {
+        return false
+    }
+
+    var apiErr *APIError
+    if !errors.As(err, &apiErr) {
+        return true
+    }
+    for _, s := range p.RetryableStatus {
+        if s == apiErr.StatusCode { return true }
+    }
+    return false
+}
+
+func (p *RetryPolicy) backoff(attempt int, err error) time.Duration {
+    var apiErr *APIError
+    if !p.IgnoreRetryAfter && errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+        // Don't let the server stall us for longer than we'd wait anyway.
+        if p.MaxBackoff > 0 && apiErr.RetryAfter > p.MaxBackoff { return p.MaxBackoff }
+        return apiErr.RetryAfter
+    }
+
+    mult := p.Multiplier
+    if mult < 1 { mult = 1 }
+    d := float64(p.InitialBackoff) * math.Pow(mult, float64(attempt - 1))
+    if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+        d = float64(p.MaxBackoff)
+    }
+    if p.Jitter > 0 {
+        d += d * p.Jitter * (2 * rand.Float64() - 1)
+    }
+    return time.Duration(d)
+}
+
+// withRetries runs fn according to the policy, until it succeeds, fails in
+// a way not worth retrying, runs out of attempts or ctx is done. fn returns
+// the HTTP status code it got, if any.
+func (p *RetryPolicy) withRetries(ctx context.Context, endpoint string, fn func() (int, error)) error {
+    for n := 1; ; n++ {
+        start := time.Now()
+        status, err := fn()
+
+        a := Attempt{Endpoint: endpoint, Number: n, StatusCode: status, Err: err, Duration: time.Since(start)}
+        var apiErr *APIError
+        if errors.As(err, &apiErr) {
+            a.StatusCode = apiErr.StatusCode
+        }
+
+        retry := err != nil && n < p.MaxAttempts && ctx.Err() == nil && p.retryable(err)
+        if retry { a.Delay = p.backoff(n, err) }
+        if p.OnAttempt != nil { p.OnAttempt(a) }
+        if !retry { return err }
+
+        t := time.NewTimer(a.Delay)
+        select {
+        case <-ctx.Done():
+            t.Stop()
+            return ctx.Err()
+        case <-t.C:
+        }
+    }
+}
@@ -0,0 +1,120 @@
+package bapi_test
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func TestRetries(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    failures := 2
+    srv.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+        if failures == 0 { return false }
+        failures--
+        w.WriteHeader(http.StatusBadGateway)
+        return true
+    })
+
+    var attempts []bapi.Attempt
+    p := bapi.DefaultRetryPolicy
+    p.InitialBackoff = time.Millisecond
+    p.OnAttempt = func(a bapi.Attempt) { attempts = append(attempts, a) }
+    c := bapi.NewWithOptions(srv.URL, bapi.WithRetryPolicy(p))
+
+    _, err := c.Ignored()
+    if err != nil { t.Fatal(err) }
+
+    if len(attempts) != 3 {
+        t.Fatalf("got %v attempts, want 3", len(attempts))
+    }
+    for i, want := range []int{502, 502, 200} {
+        if attempts[i].StatusCode != want || attempts[i].Number != i + 1 {
+            t.Errorf("attempt %v: got %+v", i, attempts[i])
+        }
+    }
+
+    // 404s are not worth retrying.
+    attempts = nil
+    _, err = c.GlobalTicker("XYZ")
+    if !errors.Is(err, bapi.ErrUnknownSymbol) || len(attempts) != 1 {
+        t.Errorf("got %v after %v attempts", err, len(attempts))
+    }
+}
+
+func TestRetryBackoff(t *testing.T) {
+    p := bapi.RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+    for n, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+        if got := p.Backoff(n + 1, errors.New("reset")); got != want {
+            t.Errorf("attempt %v: got %v, want %v", n + 1, got, want)
+        }
+    }
+
+    p.Jitter = 0.5
+    for i := 0; i < 100; i++ {
+        if got := p.Backoff(2, nil); got < time.Second || got > 3 * time.Second {
+            t.Fatalf("got %v with jitter", got)
+        }
+    }
+}
+
+func TestRetryAfter(t *testing.T) {
+    p := bapi.RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second, Multiplier: 2}
+    for _, c := range []struct{
+        after   time.Duration
+        want    time.Duration
+    }{
+        {3 * time.Second, 3 * time.Second},
+        // A server asking for more than MaxBackoff doesn't get it.
+        {time.Hour, 10 * time.Second},
+    } {
+        err := &bapi.APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: c.after}
+        if got := p.Backoff(1, err); got != c.want {
+            t.Errorf("Retry-After %v: got %v, want %v", c.after, got, c.want)
+        }
+    }
+
+    p.IgnoreRetryAfter = true
+    if got := p.Backoff(1, &bapi.APIError{StatusCode: 503, RetryAfter: 3 * time.Second}); got != time.Second {
+        t.Errorf("got %v, want the policy's own backoff", got)
+    }
+}
+
+func TestRetryTransportErrors(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    failures := 1
+    rt := bapi.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+        if failures > 0 {
+            failures--
+            return nil, errors.New("connection reset by peer")
+        }
+        return http.DefaultTransport.RoundTrip(r)
+    })
+    p := bapi.DefaultRetryPolicy
+    p.InitialBackoff = time.Millisecond
+    c := bapi.NewWithOptions(srv.URL, bapi.WithTransport(rt), bapi.WithRetryPolicy(p))
+
+    if _, err := c.Ignored(); err != nil { t.Fatal(err) }
+    if failures != 0 || len(srv.Requests()) != 1 {
+        t.Errorf("got %v failures left, %v requests", failures, len(srv.Requests()))
+    }
+
+    // Giving up while backing off.
+    failures = 10
+    p.InitialBackoff = time.Hour
+    c = bapi.NewWithOptions(srv.URL, bapi.WithTransport(rt), bapi.WithRetryPolicy(p))
+    ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Millisecond)
+    defer cancel()
+    if _, err := c.IgnoredContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("got %v, want context.DeadlineExceeded", err)
+    }
+}
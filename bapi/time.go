@@ -0,0 +1,84 @@
+package bapi
+
+import (
+    "encoding/json"
+    "strings"
+    "time"
+    "fmt"
+)
+
+// timeLayouts lists every timestamp format the API has been seen using, most
+// common first: RFC 1123 for JSON timestamps, plain date and time for the
+// history CSVs.
+var timeLayouts = []string{
+    time.RFC1123Z,
+    time.RFC1123,
+    "Mon, 2 Jan 2006 15:04:05 -0700",
+    "Mon, 2 Jan 2006 15:04:05 MST",
+    "2006-01-02 15:04:05",
+    "2006-01-02 15:04",
+    "2006-01-02",
+    time.RFC3339Nano,
+    "2006-01-02T15:04:05",
+}
+
+// TimeParseError is returned when a timestamp or datetime field is in none of
+// the known formats.
+type TimeParseError struct {
+    // Field is the JSON key or CSV column the value came from, if known.
+    Field           string
+    Value           string
+}
+
+func (e *TimeParseError) Error() string {
+    if e.Field == "" {
+        return fmt.Sprintf("cannot parse time %q.", e.Value)
+    }
+    return fmt.Sprintf("cannot parse %v %q.", e.Field, e.Value)
+}
+
+// ParseTime parses any of the timestamp formats used by the API. The result
+// is always in UTC.
+func ParseTime(s string) (time.Time, error) {
+    return parseTimeField("", s)
+}
+
+func parseTimeField(field, s string) (time.Time, error) {
+    v := strings.TrimSpace(s)
+    for _, layout := range timeLayouts {
+        t, err := time.Parse(layout, v)
+        if err == nil {
+            return t.UTC(), nil
+        }
+    }
+    return time.Time{}, &TimeParseError{Field: field, Value: s}
+}
+
+// timeField is like parseTimeField, except that a missing value is zero time
+// rather than an error.
+func timeField(field, s string) (time.Time, error) {
+    if strings.TrimSpace(s) == "" { return time.Time{}, nil }
+    return parseTimeField(field, s)
+}
+
+// jsonTimeField decodes a JSON string holding a timestamp.
+func jsonTimeField(field string, data json.RawMessage) (time.Time, error) {
+    var s string
+    err := json.Unmarshal(data, &s)
+    if err != nil { return time.Time{}, err }
+    return timeField(field, s)
+}
+
+func (t *Ticker) UnmarshalJSON(data []byte) error {
+    type ticker Ticker
+    var aux struct {
+        ticker
+        Timestamp   string  `json:"timestamp"`
+    }
+    err := json.Unmarshal(data, &aux)
+    if err != nil { return err }
+
+    *t = Ticker(aux.ticker)
+    t.Timestamp, err = timeField("timestamp", aux.Timestamp)
+    return err
+}
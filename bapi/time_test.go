@@ -0,0 +1,101 @@
+package bapi_test
+
+import (
+    "errors"
+    "io"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func TestParseTime(t *testing.T) {
+    want := time.Date(2014, 11, 4, 14, 22, 3, 0, time.UTC)
+    for _, in := range []string{
+        "Tue, 04 Nov 2014 14:22:03 -0000",
+        "Tue, 04 Nov 2014 14:22:03 +0000",
+        "Tue, 04 Nov 2014 15:22:03 +0100",
+        "Tue, 04 Nov 2014 14:22:03 GMT",
+        "Tue, 4 Nov 2014 14:22:03 -0000",
+        "2014-11-04 14:22:03",
+        "2014-11-04T14:22:03Z",
+        " 2014-11-04 14:22:03 ",
+    } {
+        got, err := bapi.ParseTime(in)
+        if err != nil {
+            t.Errorf("%q: %v", in, err)
+            continue
+        }
+        if !got.Equal(want) || got.Location() != time.UTC {
+            t.Errorf("%q: got %v, want %v", in, got, want)
+        }
+    }
+
+    _, err := bapi.ParseTime("yesterday")
+    var tpErr *bapi.TimeParseError
+    if !errors.As(err, &tpErr) || tpErr.Value != "yesterday" {
+        t.Errorf("got %v, want a *TimeParseError", err)
+    }
+}
+
+func TestTimeFieldErrors(t *testing.T) {
+    var tk bapi.Ticker
+    err := tk.UnmarshalJSON([]byte(`{"last": 1, "timestamp": "Tuesday"}`))
+    var tpErr *bapi.TimeParseError
+    if !errors.As(err, &tpErr) || tpErr.Field != "timestamp" {
+        t.Errorf("got %v, want a *TimeParseError for timestamp", err)
+    }
+
+    err = tk.UnmarshalJSON([]byte(`{"last": 1}`))
+    if err != nil || !tk.Timestamp.IsZero() || !tk.Last.Equal(dec("1")) {
+        t.Errorf("missing timestamp: got %+v, %v", tk, err)
+    }
+}
+
+func TestTimeParseErrorMessage(t *testing.T) {
+    if got := (&bapi.TimeParseError{Value: "x"}).Error(); got != `cannot parse time "x".` {
+        t.Errorf("got %q", got)
+    }
+    if got := (&bapi.TimeParseError{Field: "datetime", Value: "x"}).Error(); got != `cannot parse datetime "x".` {
+        t.Errorf("got %q", got)
+    }
+}
+
+func TestResponseTimes(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    el, err := c.Exchanges("USD")
+    if err != nil { t.Fatal(err) }
+    if el.Timestamp.IsZero() || el.Timestamp.Location() != time.UTC {
+        t.Errorf("got exchange list timestamp %v, want it in UTC", el.Timestamp)
+    }
+    rs, err := c.DailyHistory("USD")
+    if err != nil { t.Fatal(err) }
+    if want := time.Date(2014, 10, 29, 0, 0, 0, 0, time.UTC); !rs[0].DateTime.Equal(want) || rs[0].DateTime.Location() != time.UTC {
+        t.Errorf("got datetime %v, want %v", rs[0].DateTime, want)
+    }
+
+    srv.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+        if strings.HasSuffix(r.URL.Path, ".csv") {
+            io.WriteString(w, "datetime,high,low,average,volume\nsoon,1,1,1,1\n")
+        } else {
+            io.WriteString(w, `{"timestamp": "Tuesday"}`)
+        }
+        return true
+    })
+    for name, call := range map[string]func() error{
+        "timestamp": func() error { _, err := c.Exchanges("USD"); return err },
+        "datetime":  func() error { _, err := c.DailyHistory("USD"); return err },
+    } {
+        err := call()
+        var tpErr *bapi.TimeParseError
+        if !errors.As(err, &tpErr) || tpErr.Field != name {
+            t.Errorf("%v: got %v, want a *TimeParseError", name, err)
+        }
+    }
+}
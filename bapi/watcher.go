@@ -0,0 +1,187 @@
+package bapi
+
+import (
+    "context"
+    "sort"
+    "time"
+)
+
+// TickerUpdate is sent by a Watcher whenever a ticker changes.
+type TickerUpdate struct {
+    Symbol          string
+    Ticker          Ticker
+    // Previous is nil for the first value seen for Symbol.
+    Previous        *Ticker
+}
+
+// Watcher polls tickers and reports the ones that changed since the last
+// poll. Upstream refreshes its tickers roughly once a minute, so rather than
+// polling on a fixed clock the Watcher schedules each poll Interval + Delay
+// after the newest ticker timestamp it has seen, and only falls back to
+// polling every Recheck when upstream is running late.
+type Watcher struct {
+    Client          Client
+    // Symbols to poll one by one. If empty, all tickers are fetched in one
+    // request instead.
+    Symbols         []string
+    // Market selects market tickers instead of global ones.
+    Market          bool
+    // Interval is the upstream update cadence. Zero means a minute.
+    Interval        time.Duration
+    // Delay gives upstream some slack past the expected update time.
+    Delay           time.Duration
+    // Recheck is how often to poll while an update is overdue. Zero means a
+    // minute.
+    Recheck         time.Duration
+    // MaxBackoff caps the wait between polls after consecutive errors. The
+    // wait starts at Recheck and doubles on every failure.
+    MaxBackoff      time.Duration
+    // OnError, if set, is called with every failed poll.
+    OnError         func(error)
+}
+
+// NewWatcher returns a Watcher over the global tickers for symbols (or all
+// of them, if none are given) with the default schedule.
+func NewWatcher(c Client, symbols ...string) *Watcher {
+    return &Watcher{
+        Client:     c,
+        Symbols:    symbols,
+        Interval:   time.Minute,
+        Delay:      5 * time.Second,
+        Recheck:    10 * time.Second,
+        MaxBackoff: 5 * time.Minute,
+    }
+}
+
+// Watch starts polling and returns the channel updates are sent on. The
+// channel is closed once ctx is done. Each call to Watch polls independently.
+func (w *Watcher) Watch(ctx context.Context) <-chan TickerUpdate {
+    ch := make(chan TickerUpdate)
+    go w.run(ctx, ch)
+    return ch
+}
+
+func (w *Watcher) run(ctx context.Context, ch chan<- TickerUpdate) {
+    defer close(ch)
+
+    seen := make(map[string]Ticker)
+    backoff := time.Duration(0)
+    timer := time.NewTimer(0)
+    defer timer.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-timer.C:
+        }
+
+        tickers, err := w.poll(ctx)
+        if err != nil {
+            if ctx.Err() != nil { return }
+            if w.OnError != nil { w.OnError(err) }
+            if backoff == 0 {
+                backoff = w.recheck()
+            } else {
+                backoff *= 2
+            }
+            if w.MaxBackoff > 0 && backoff > w.MaxBackoff { backoff = w.MaxBackoff }
+            timer.Reset(backoff)
+            continue
+        }
+        backoff = 0
+
+        var latest time.Time
+        for _, symbol := range w.order(tickers) {
+            t := tickers[symbol]
+            if t.Timestamp.After(latest) { latest = t.Timestamp }
+
+            prev, ok := seen[symbol]
+            if ok && !tickerChanged(prev, t) { continue }
+            seen[symbol] = t
+
+            u := TickerUpdate{Symbol: symbol, Ticker: t}
+            if ok { u.Previous = &prev }
+            select {
+            case ch <- u:
+            case <-ctx.Done():
+                return
+            }
+        }
+        timer.Reset(w.next(latest, time.Now()))
+    }
+}
+
+// interval and recheck default the schedule for Watchers that don't set it,
+// which would otherwise poll in a tight loop.
+func (w *Watcher) interval() time.Duration {
+    if w.Interval > 0 { return w.Interval }
+    return time.Minute
+}
+
+func (w *Watcher) recheck() time.Duration {
+    if w.Recheck > 0 { return w.Recheck }
+    return time.Minute
+}
+
+// next works out how long to wait before polling again, given the newest
+// ticker timestamp seen.
+func (w *Watcher) next(latest, now time.Time) time.Duration {
+    interval := w.interval()
+    if latest.IsZero() { return interval }
+
+    d := latest.Add(interval + w.Delay).Sub(now)
+    if d <= 0 { return w.recheck() }
+    // Don't trust timestamps from the future.
+    if d > interval + w.Delay { return interval }
+    return d
+}
+
+func (w *Watcher) poll(ctx context.Context) (map[string]Ticker, error) {
+    if len(w.Symbols) == 0 {
+        var all *AllTickers
+        var err error
+        if w.Market {
+            all, err = w.Client.MarketTickersContext(ctx)
+        } else {
+            all, err = w.Client.GlobalTickersContext(ctx)
+        }
+        if err != nil { return nil, err }
+        return all.Tickers, nil
+    }
+
+    tickers := make(map[string]Ticker, len(w.Symbols))
+    for _, symbol := range w.Symbols {
+        var t *Ticker
+        var err error
+        if w.Market {
+            t, err = w.Client.MarketTickerContext(ctx, symbol)
+        } else {
+            t, err = w.Client.GlobalTickerContext(ctx, symbol)
+        }
+        if err != nil { return nil, err }
+        tickers[symbol] = *t
+    }
+    return tickers, nil
+}
+
+// order returns the symbols in tickers in the order updates should be sent:
+// that of Symbols if set, alphabetical otherwise.
+func (w *Watcher) order(tickers map[string]Ticker) []string {
+    if len(w.Symbols) > 0 { return w.Symbols }
+    symbols := make([]string, 0, len(tickers))
+    for symbol := range tickers { symbols = append(symbols, symbol) }
+    sort.Strings(symbols)
+    return symbols
+}
+
+func tickerChanged(a, b Ticker) bool {
+    return !a.Timestamp.Equal(b.Timestamp) ||
+        !a.Last.Equal(b.Last) ||
+        !a.Bid.Equal(b.Bid) ||
+        !a.Ask.Equal(b.Ask) ||
+        !a.Average24h.Equal(b.Average24h) ||
+        !a.VolumeBTC.Equal(b.VolumeBTC) ||
+        !a.VolumePercent.Equal(b.VolumePercent) ||
+        !a.TotalVolume.Equal(b.TotalVolume)
+}
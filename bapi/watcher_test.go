@@ -0,0 +1,116 @@
+package bapi_test
+
+import (
+    "context"
+    "net/http"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func TestWatcher(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    var mu sync.Mutex
+    last, fail := "329.97", 0
+    srv.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+        if r.URL.Path != "/ticker/global/USD" { return false }
+        mu.Lock()
+        defer mu.Unlock()
+        if fail > 0 {
+            fail--
+            http.Error(w, "down", http.StatusBadGateway)
+            return true
+        }
+        w.Write([]byte(`{"last": ` + last + `, "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000"}`))
+        return true
+    })
+
+    errs := make(chan error, 10)
+    w := bapi.NewWatcher(bapi.NewWithOptions(srv.URL), "USD")
+    w.Recheck = 5 * time.Millisecond
+    w.MaxBackoff = 20 * time.Millisecond
+    w.OnError = func(err error) { errs <- err }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    updates := w.Watch(ctx)
+
+    u := <-updates
+    if u.Symbol != "USD" || u.Previous != nil || !u.Ticker.Last.Equal(dec("329.97")) {
+        t.Fatalf("got %+v", u)
+    }
+
+    // Unchanged tickers are not sent again, and errors don't stop polling.
+    time.Sleep(30 * time.Millisecond)
+    mu.Lock()
+    last, fail = "330.5", 2
+    mu.Unlock()
+
+    u = <-updates
+    if u.Previous == nil || !u.Previous.Last.Equal(dec("329.97")) || !u.Ticker.Last.Equal(dec("330.5")) {
+        t.Fatalf("got %+v", u)
+    }
+    if len(errs) != 2 {
+        t.Errorf("got %v errors, want 2", len(errs))
+    }
+
+    cancel()
+    for range updates {}
+}
+
+func TestWatcherSchedule(t *testing.T) {
+    w := bapi.NewWatcher(nil)
+    now := time.Date(2014, 11, 4, 14, 22, 30, 0, time.UTC)
+
+    for _, c := range []struct{
+        latest  time.Time
+        want    time.Duration
+    }{
+        {time.Time{}, time.Minute},
+        {now.Add(-30 * time.Second), 35 * time.Second},
+        {now.Add(-2 * time.Minute), 10 * time.Second},
+        {now.Add(time.Hour), time.Minute},
+    } {
+        if got := w.Next(c.latest, now); got != c.want {
+            t.Errorf("next(%v): got %v, want %v", c.latest, got, c.want)
+        }
+    }
+}
+
+func TestWatcherDefaults(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    srv.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+        http.Error(w, "down", http.StatusBadGateway)
+        return true
+    })
+
+    // A bare Watcher waits a minute, rather than not at all.
+    var mu sync.Mutex
+    errs := 0
+    w := &bapi.Watcher{Client: bapi.NewWithOptions(srv.URL), OnError: func(error) {
+        mu.Lock()
+        defer mu.Unlock()
+        errs++
+    }}
+    now := time.Date(2014, 11, 4, 14, 22, 30, 0, time.UTC)
+    for _, latest := range []time.Time{{}, now.Add(-2 * time.Minute)} {
+        if got := w.Next(latest, now); got != time.Minute {
+            t.Errorf("next(%v): got %v, want a minute", latest, got)
+        }
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+    defer cancel()
+    for range w.Watch(ctx) {}
+    mu.Lock()
+    defer mu.Unlock()
+    if errs != 1 || len(srv.Requests()) != 1 {
+        t.Errorf("got %v errors and %v requests in 100ms, want 1", errs, len(srv.Requests()))
+    }
+}
@@ -1,14 +1,18 @@
 package bapi
 
 import (
+    "context"
     "encoding/json"
     "encoding/csv"
     "io/ioutil"
     "net/http"
+    "io"
     "strings"
     "errors"
     "bytes"
+    "time"
     "fmt"
+    "sync/atomic"
 )
 
 var (
@@ -16,27 +20,40 @@ var (
 )
 
 type ApiClient struct {
+    // Updated atomically, keep it first so that it stays 64-bit aligned.
+    stats       CacheStats
     url         string
+    // client is the http.Client given through WithHTTPClient until
+    // NewWithOptions resolves the other options into it.
+    client      *http.Client
+    transport   http.RoundTripper
+    headers     http.Header
+    middleware  []Middleware
+    retry       RetryPolicy
+    limiter     *RateLimiter
+    cache       Cache
+    cacheTTL    func(endpoint string) time.Duration
+    flights     *flightGroup
 }
 
 type Ticker struct {
     // Average24h is not available when fetching all tickers in bulk through
     // GlobalTickers()
-    Average24h      json.Number     `json:"24h_avg"`
-    Ask             json.Number     `json:"ask"`
-    Bid             json.Number     `json:"bid"`
-    Last            json.Number     `json:"last"`
-    Timestamp       string          `json:"timestamp"`
+    Average24h      Decimal         `json:"24h_avg"`
+    Ask             Decimal         `json:"ask"`
+    Bid             Decimal         `json:"bid"`
+    Last            Decimal         `json:"last"`
+    Timestamp       time.Time       `json:"timestamp"`
     // Volume* only available for global tickers.
-    VolumeBTC       json.Number     `json:"volume_btc"`
-    VolumePercent   json.Number     `json:"volume_percent"`
+    VolumeBTC       Decimal         `json:"volume_btc"`
+    VolumePercent   Decimal         `json:"volume_percent"`
     // TotalVolume is only available for market tickers.
-    TotalVolume     json.Number     `json:"total_vol"`
+    TotalVolume     Decimal         `json:"total_vol"`
 }
 
 type AllTickers struct {
     Tickers         map[string]Ticker
-    Timestamp       string
+    Timestamp       time.Time
 }
 
 type Exchange struct {
@@ -44,83 +61,120 @@ type Exchange struct {
     DisplayName     string          `json:"display_name"`
     Rates           ExchangeRates   `json:"rates"`
     Source          string          `json:"source"`
-    VolumeBTC       json.Number     `json:"volume_btc"`
-    VolumePercent   json.Number     `json:"volume_percent"`
+    VolumeBTC       Decimal         `json:"volume_btc"`
+    VolumePercent   Decimal         `json:"volume_percent"`
 }
 
 type ExchangeRates struct {
-    Ask             json.Number     `json:"ask"`
-    Bid             json.Number     `json:"bid"`
-    Last            json.Number     `json:"last"`
+    Ask             Decimal         `json:"ask"`
+    Bid             Decimal         `json:"bid"`
+    Last            Decimal         `json:"last"`
 }
 
 type ExchangeList struct {
     Exchanges       map[string]Exchange
-    Timestamp       string
+    Timestamp       time.Time
 }
 
 type AllExchanges struct {
     Exchanges       map[string]map[string]Exchange
-    Timestamp       string
+    Timestamp       time.Time
 }
 
 type MinutelyHistoryRecord struct {
-    DateTime        string
-    Average         json.Number
+    DateTime        time.Time
+    Average         Decimal
 }
 
 type HourlyHistoryRecord struct {
-    DateTime        string
-    High            json.Number
-    Low             json.Number
-    Average         json.Number
+    DateTime        time.Time
+    High            Decimal
+    Low             Decimal
+    Average         Decimal
 }
 
 type DailyHistoryRecord struct {
-    DateTime        string
-    High            json.Number
-    Low             json.Number
-    Average         json.Number
-    Volume          json.Number
+    DateTime        time.Time
+    High            Decimal
+    Low             Decimal
+    Average         Decimal
+    Volume          Decimal
 }
 
 type VolumeHistoryRecord struct {
-    DateTime        string
-    TotalVolume     json.Number
+    DateTime        time.Time
+    TotalVolume     Decimal
     Exchanges       map[string]ExchangeVolumeHistoryRecord
 }
 
 type ExchangeVolumeHistoryRecord struct {
-    VolumeBTC       json.Number
-    VolumePercent   json.Number
+    VolumeBTC       Decimal
+    VolumePercent   Decimal
 }
 
-func New() *ApiClient {
-    return NewWithOptions(ApiUrl)
+func New(opts ...Option) *ApiClient {
+    return NewWithOptions(ApiUrl, opts...)
 }
 
-func NewWithOptions(url string) *ApiClient {
-    return &ApiClient{url: url}
+func NewWithOptions(url string, opts ...Option) *ApiClient {
+    c := &ApiClient{url: url, headers: make(http.Header), flights: &flightGroup{}}
+    for _, opt := range opts {
+        opt(c)
+    }
+    c.client = c.buildClient()
+    return c
 }
 
 func (c *ApiClient) GlobalTickerList() ([]string, error) {
-    return c.index("ticker/global/", true)
+    return c.GlobalTickerListContext(context.Background())
+}
+
+func (c *ApiClient) GlobalTickerListContext(ctx context.Context) ([]string, error) {
+    v, err := c.shared(ctx, "GlobalTickerList", func(ctx context.Context) (interface{}, error) {
+        return c.index(ctx, "ticker/global/", true)
+    })
+    if err != nil { return nil, err }
+    return v.([]string), nil
 }
 
 func (c *ApiClient) MarketTickerList() ([]string, error) {
-    return c.index("ticker/", true)
+    return c.MarketTickerListContext(context.Background())
+}
+
+func (c *ApiClient) MarketTickerListContext(ctx context.Context) ([]string, error) {
+    v, err := c.shared(ctx, "MarketTickerList", func(ctx context.Context) (interface{}, error) {
+        return c.index(ctx, "ticker/", true)
+    })
+    if err != nil { return nil, err }
+    return v.([]string), nil
 }
 
 func (c *ApiClient) ExchangeList() ([]string, error) {
-    return c.index("exchanges/", true)
+    return c.ExchangeListContext(context.Background())
+}
+
+func (c *ApiClient) ExchangeListContext(ctx context.Context) ([]string, error) {
+    v, err := c.shared(ctx, "ExchangeList", func(ctx context.Context) (interface{}, error) {
+        return c.index(ctx, "exchanges/", true)
+    })
+    if err != nil { return nil, err }
+    return v.([]string), nil
 }
 
 func (c *ApiClient) HistoryList() ([]string, error) {
-    return c.index("history/", false)
+    return c.HistoryListContext(context.Background())
+}
+
+func (c *ApiClient) HistoryListContext(ctx context.Context) ([]string, error) {
+    v, err := c.shared(ctx, "HistoryList", func(ctx context.Context) (interface{}, error) {
+        return c.index(ctx, "history/", false)
+    })
+    if err != nil { return nil, err }
+    return v.([]string), nil
 }
 
-func (c *ApiClient) index(endpoint string, hasAll bool) ([]string, error) {
-    data, err := c.apiCall(endpoint)
+func (c *ApiClient) index(ctx context.Context, endpoint string, hasAll bool) ([]string, error) {
+    data, err := c.apiCall(ctx, endpoint)
     if err != nil { return nil, err }
 
     var ti map[string]string
@@ -141,15 +195,31 @@ func (c *ApiClient) index(endpoint string, hasAll bool) ([]string, error) {
 }
 
 func (c *ApiClient) GlobalTicker(symbol string) (*Ticker, error) {
-    return c.ticker("ticker/global/", symbol)
+    return c.GlobalTickerContext(context.Background(), symbol)
+}
+
+func (c *ApiClient) GlobalTickerContext(ctx context.Context, symbol string) (*Ticker, error) {
+    v, err := c.shared(ctx, "GlobalTicker/" + symbol, func(ctx context.Context) (interface{}, error) {
+        return c.ticker(ctx, "ticker/global/", symbol)
+    })
+    if err != nil { return nil, err }
+    return v.(*Ticker), nil
 }
 
 func (c *ApiClient) MarketTicker(symbol string) (*Ticker, error) {
-    return c.ticker("ticker/", symbol)
+    return c.MarketTickerContext(context.Background(), symbol)
+}
+
+func (c *ApiClient) MarketTickerContext(ctx context.Context, symbol string) (*Ticker, error) {
+    v, err := c.shared(ctx, "MarketTicker/" + symbol, func(ctx context.Context) (interface{}, error) {
+        return c.ticker(ctx, "ticker/", symbol)
+    })
+    if err != nil { return nil, err }
+    return v.(*Ticker), nil
 }
 
-func (c *ApiClient) ticker(endpoint string, symbol string) (*Ticker, error) {
-    data, err := c.apiCall(endpoint + symbol)
+func (c *ApiClient) ticker(ctx context.Context, endpoint string, symbol string) (*Ticker, error) {
+    data, err := c.apiCall(ctx, endpoint + symbol)
     if err != nil { return nil, err }
 
     var t Ticker
@@ -160,15 +230,31 @@ func (c *ApiClient) ticker(endpoint string, symbol string) (*Ticker, error) {
 }
 
 func (c *ApiClient) GlobalTickers() (*AllTickers, error) {
-    return c.tickers("ticker/global/all")
+    return c.GlobalTickersContext(context.Background())
+}
+
+func (c *ApiClient) GlobalTickersContext(ctx context.Context) (*AllTickers, error) {
+    v, err := c.shared(ctx, "GlobalTickers", func(ctx context.Context) (interface{}, error) {
+        return c.tickers(ctx, "ticker/global/all")
+    })
+    if err != nil { return nil, err }
+    return v.(*AllTickers), nil
 }
 
 func (c *ApiClient) MarketTickers() (*AllTickers, error) {
-    return c.tickers("ticker/all")
+    return c.MarketTickersContext(context.Background())
 }
 
-func (c *ApiClient) tickers(endpoint string) (*AllTickers, error) {
-    data, err := c.apiCall(endpoint)
+func (c *ApiClient) MarketTickersContext(ctx context.Context) (*AllTickers, error) {
+    v, err := c.shared(ctx, "MarketTickers", func(ctx context.Context) (interface{}, error) {
+        return c.tickers(ctx, "ticker/all")
+    })
+    if err != nil { return nil, err }
+    return v.(*AllTickers), nil
+}
+
+func (c *ApiClient) tickers(ctx context.Context, endpoint string) (*AllTickers, error) {
+    data, err := c.apiCall(ctx, endpoint)
     if err != nil { return nil, err }
 
     // The API returns a nice map of symbols to Ticker, plus a timestamp...
@@ -180,7 +266,7 @@ func (c *ApiClient) tickers(endpoint string) (*AllTickers, error) {
     at.Tickers = make(map[string]Ticker)
     for k, v := range td {
         if k == "timestamp" {
-            err = json.Unmarshal(v, &at.Timestamp)
+            at.Timestamp, err = jsonTimeField("timestamp", v)
             if err != nil { return nil, err }
             continue
         }
@@ -195,225 +281,455 @@ func (c *ApiClient) tickers(endpoint string) (*AllTickers, error) {
 }
 
 func (c *ApiClient) Exchanges(symbol string) (*ExchangeList, error) {
-    data, err := c.apiCall("exchanges/" + symbol)
-    if err != nil { return nil, err }
+    return c.ExchangesContext(context.Background(), symbol)
+}
 
-    // The API returns a nice map of names to Exchange, plus a timestamp...
-    var ed map[string]json.RawMessage
-    err = json.Unmarshal(data, &ed)
-    if err != nil { return nil, err }
+func (c *ApiClient) ExchangesContext(ctx context.Context, symbol string) (*ExchangeList, error) {
+    v, err := c.shared(ctx, "Exchanges/" + symbol, func(ctx context.Context) (interface{}, error) {
+        data, err := c.apiCall(ctx, "exchanges/" + symbol)
+        if err != nil { return nil, err }
 
-    var el ExchangeList
-    el.Exchanges = make(map[string]Exchange)
-    for k, v := range ed {
-        if k == "timestamp" {
-            err = json.Unmarshal(v, &el.Timestamp)
+        // The API returns a nice map of names to Exchange, plus a timestamp...
+        var ed map[string]json.RawMessage
+        err = json.Unmarshal(data, &ed)
+        if err != nil { return nil, err }
+
+        var el ExchangeList
+        el.Exchanges = make(map[string]Exchange)
+        for k, v := range ed {
+            if k == "timestamp" {
+                el.Timestamp, err = jsonTimeField("timestamp", v)
+                if err != nil { return nil, err }
+                continue
+            }
+
+            var e Exchange
+            err = json.Unmarshal(v, &e)
             if err != nil { return nil, err }
-            continue
+            el.Exchanges[k] = e
         }
 
-        var e Exchange
-        err = json.Unmarshal(v, &e)
-        if err != nil { return nil, err }
-        el.Exchanges[k] = e
-    }
-
-    return &el, nil
+        return &el, nil
+    })
+    if err != nil { return nil, err }
+    return v.(*ExchangeList), nil
 }
 
 func (c *ApiClient) AllExchanges() (*AllExchanges, error) {
-    data, err := c.apiCall("exchanges/all")
-    if err != nil { return nil, err }
+    return c.AllExchangesContext(context.Background())
+}
 
-    // The API returns a nice map of symbols to Exchange, plus a timestamp...
-    var ed map[string]json.RawMessage
-    err = json.Unmarshal(data, &ed)
-    if err != nil { return nil, err }
+func (c *ApiClient) AllExchangesContext(ctx context.Context) (*AllExchanges, error) {
+    v, err := c.shared(ctx, "AllExchanges", func(ctx context.Context) (interface{}, error) {
+        data, err := c.apiCall(ctx, "exchanges/all")
+        if err != nil { return nil, err }
 
-    var ae AllExchanges
-    ae.Exchanges = make(map[string]map[string]Exchange)
-    for k, v := range ed {
-        if k == "timestamp" {
-            err = json.Unmarshal(v, &ae.Timestamp)
+        // The API returns a nice map of symbols to Exchange, plus a timestamp...
+        var ed map[string]json.RawMessage
+        err = json.Unmarshal(data, &ed)
+        if err != nil { return nil, err }
+
+        var ae AllExchanges
+        ae.Exchanges = make(map[string]map[string]Exchange)
+        for k, v := range ed {
+            if k == "timestamp" {
+                ae.Timestamp, err = jsonTimeField("timestamp", v)
+                if err != nil { return nil, err }
+                continue
+            }
+
+            var e map[string]Exchange
+            err = json.Unmarshal(v, &e)
             if err != nil { return nil, err }
-            continue
+            ae.Exchanges[k] = e
         }
 
-        var e map[string]Exchange
-        err = json.Unmarshal(v, &e)
-        if err != nil { return nil, err }
-        ae.Exchanges[k] = e
-    }
-
-    return &ae, nil
+        return &ae, nil
+    })
+    if err != nil { return nil, err }
+    return v.(*AllExchanges), nil
 }
 
+// StopIteration can be returned by the callbacks given to the *HistoryEach
+// methods to stop early without error.
+var StopIteration = errors.New("stop iteration.")
+
 func (c *ApiClient) MinutelyHistory(symbol string) ([]MinutelyHistoryRecord, error) {
-    header, records, err := c.csvCall("history/" + symbol + "/per_minute_24h_sliding_window.csv")
+    return c.MinutelyHistoryContext(context.Background(), symbol)
+}
+
+func (c *ApiClient) MinutelyHistoryContext(ctx context.Context, symbol string) ([]MinutelyHistoryRecord, error) {
+    v, err := c.shared(ctx, "MinutelyHistory/" + symbol, func(ctx context.Context) (interface{}, error) {
+        rs := make([]MinutelyHistoryRecord, 0)
+        err := c.MinutelyHistoryEach(ctx, symbol, func(r MinutelyHistoryRecord) error {
+            rs = append(rs, r)
+            return nil
+        })
+        if err != nil { return nil, err }
+
+        return rs, nil
+    })
     if err != nil { return nil, err }
+    return v.([]MinutelyHistoryRecord), nil
+}
 
-    rs := make([]MinutelyHistoryRecord, len(records))
-    for idx, record := range records {
+// MinutelyHistoryEach calls fn for each record as it is read off the wire.
+func (c *ApiClient) MinutelyHistoryEach(ctx context.Context, symbol string, fn func(MinutelyHistoryRecord) error) error {
+    return c.csvEach(ctx, "history/" + symbol + "/per_minute_24h_sliding_window.csv", func(header, record []string) error {
         var r MinutelyHistoryRecord
+        var err error
 
         for i, column := range header {
             switch column {
-            case "datetime": r.DateTime = record[i];
-            case "average": r.Average = json.Number(record[i]);
-            default: return nil, errors.New("got unexpected CSV columns.")
+            case "datetime": r.DateTime, err = timeField("datetime", record[i])
+            case "average": r.Average, err = decimalField(record[i])
+            default: return errors.New("got unexpected CSV columns.")
             }
+            if err != nil { return err }
         }
 
-        rs[idx] = r
-    }
-
-    return rs, nil
+        return fn(r)
+    })
 }
 
 func (c *ApiClient) HourlyHistory(symbol string) ([]HourlyHistoryRecord, error) {
-    header, records, err := c.csvCall("history/" + symbol + "/per_hour_monthly_sliding_window.csv")
+    return c.HourlyHistoryContext(context.Background(), symbol)
+}
+
+func (c *ApiClient) HourlyHistoryContext(ctx context.Context, symbol string) ([]HourlyHistoryRecord, error) {
+    v, err := c.shared(ctx, "HourlyHistory/" + symbol, func(ctx context.Context) (interface{}, error) {
+        rs := make([]HourlyHistoryRecord, 0)
+        err := c.HourlyHistoryEach(ctx, symbol, func(r HourlyHistoryRecord) error {
+            rs = append(rs, r)
+            return nil
+        })
+        if err != nil { return nil, err }
+
+        return rs, nil
+    })
     if err != nil { return nil, err }
+    return v.([]HourlyHistoryRecord), nil
+}
 
-    rs := make([]HourlyHistoryRecord, len(records))
-    for idx, record := range records {
+// HourlyHistoryEach calls fn for each record as it is read off the wire.
+func (c *ApiClient) HourlyHistoryEach(ctx context.Context, symbol string, fn func(HourlyHistoryRecord) error) error {
+    return c.csvEach(ctx, "history/" + symbol + "/per_hour_monthly_sliding_window.csv", func(header, record []string) error {
         var r HourlyHistoryRecord
+        var err error
 
         for i, column := range header {
             switch column {
-            case "datetime": r.DateTime = record[i];
-            case "high": r.High = json.Number(record[i]);
-            case "low": r.Low = json.Number(record[i]);
-            case "average": r.Average = json.Number(record[i]);
-            default: return nil, errors.New("got unexpected CSV columns.")
+            case "datetime": r.DateTime, err = timeField("datetime", record[i])
+            case "high": r.High, err = decimalField(record[i])
+            case "low": r.Low, err = decimalField(record[i])
+            case "average": r.Average, err = decimalField(record[i])
+            default: return errors.New("got unexpected CSV columns.")
             }
+            if err != nil { return err }
         }
 
-        rs[idx] = r
-    }
-
-    return rs, nil
+        return fn(r)
+    })
 }
 
 func (c *ApiClient) DailyHistory(symbol string) ([]DailyHistoryRecord, error) {
-    header, records, err := c.csvCall("history/" + symbol + "/per_day_all_time_history.csv")
+    return c.DailyHistoryContext(context.Background(), symbol)
+}
+
+func (c *ApiClient) DailyHistoryContext(ctx context.Context, symbol string) ([]DailyHistoryRecord, error) {
+    v, err := c.shared(ctx, "DailyHistory/" + symbol, func(ctx context.Context) (interface{}, error) {
+        rs := make([]DailyHistoryRecord, 0)
+        err := c.DailyHistoryEach(ctx, symbol, func(r DailyHistoryRecord) error {
+            rs = append(rs, r)
+            return nil
+        })
+        if err != nil { return nil, err }
+
+        return rs, nil
+    })
     if err != nil { return nil, err }
+    return v.([]DailyHistoryRecord), nil
+}
 
-    rs := make([]DailyHistoryRecord, len(records))
-    for idx, record := range records {
+// DailyHistoryEach calls fn for each record as it is read off the wire.
+func (c *ApiClient) DailyHistoryEach(ctx context.Context, symbol string, fn func(DailyHistoryRecord) error) error {
+    return c.csvEach(ctx, "history/" + symbol + "/per_day_all_time_history.csv", func(header, record []string) error {
         var r DailyHistoryRecord
+        var err error
 
         for i, column := range header {
             switch column {
-            case "datetime": r.DateTime = record[i];
-            case "high": r.High = json.Number(record[i]);
-            case "low": r.Low = json.Number(record[i]);
-            case "average": r.Average = json.Number(record[i]);
-            case "volume": r.Volume = json.Number(record[i]);
-            default: return nil, errors.New("got unexpected CSV columns.")
+            case "datetime": r.DateTime, err = timeField("datetime", record[i])
+            case "high": r.High, err = decimalField(record[i])
+            case "low": r.Low, err = decimalField(record[i])
+            case "average": r.Average, err = decimalField(record[i])
+            case "volume": r.Volume, err = decimalField(record[i])
+            default: return errors.New("got unexpected CSV columns.")
             }
+            if err != nil { return err }
         }
 
-        rs[idx] = r
-    }
-
-    return rs, nil
+        return fn(r)
+    })
 }
 
 func (c *ApiClient) VolumeHistory(symbol string) ([]VolumeHistoryRecord, error) {
-    // Fetch CSV
-    header, records, err := c.csvCall("history/" + symbol + "/volumes.csv")
+    return c.VolumeHistoryContext(context.Background(), symbol)
+}
+
+func (c *ApiClient) VolumeHistoryContext(ctx context.Context, symbol string) ([]VolumeHistoryRecord, error) {
+    v, err := c.shared(ctx, "VolumeHistory/" + symbol, func(ctx context.Context) (interface{}, error) {
+        var rs []VolumeHistoryRecord
+        err := c.VolumeHistoryEach(ctx, symbol, func(r VolumeHistoryRecord) error {
+            rs = append(rs, r)
+            return nil
+        })
+        if err != nil { return nil, err }
+
+        return rs, nil
+    })
     if err != nil { return nil, err }
+    return v.([]VolumeHistoryRecord), nil
+}
 
-    // Process as best we can
-    var rs []VolumeHistoryRecord
-    for _, record := range records {
+// VolumeHistoryEach calls fn for each record as it is read off the wire.
+// Bogus records are skipped, as with VolumeHistory.
+func (c *ApiClient) VolumeHistoryEach(ctx context.Context, symbol string, fn func(VolumeHistoryRecord) error) error {
+    return c.csvEach(ctx, "history/" + symbol + "/volumes.csv", func(header, record []string) error {
+        // Process as best we can
         var r VolumeHistoryRecord
+        var err error
         r.Exchanges = make(map[string]ExchangeVolumeHistoryRecord)
+        raw := make(map[string][2]string)
 
         for i, column := range header {
             switch column {
-            case "datetime": r.DateTime = record[i];
-            case "total_vol": r.TotalVolume = json.Number(record[i]);
+            case "datetime": r.DateTime, err = timeField("datetime", record[i])
+            case "total_vol": r.TotalVolume, err = decimalField(record[i])
             default:
                 m := strings.Split(column, " ")
-                if len(m) != 2 { return nil, errors.New("got malformed CSV data.") }
-                val := r.Exchanges[m[0]]
+                if len(m) != 2 { return errors.New("got malformed CSV data.") }
+                val := raw[m[0]]
                 if m[1] == "BTC" {
-                    val.VolumeBTC = json.Number(record[i])
+                    val[0] = record[i]
                 } else {
-                    val.VolumePercent = json.Number(record[i])
+                    val[1] = record[i]
                 }
-                r.Exchanges[m[0]] = val
+                raw[m[0]] = val
             }
+            if err != nil { return err }
         }
 
         // Filter bogus data (argggggggg......)
-        for k, v := range r.Exchanges {
-            if (v.VolumeBTC == "" || v.VolumePercent == "") ||
-               (v.VolumeBTC == "0" && v.VolumePercent == "0") {
-                   delete(r.Exchanges, k)
-            }
-        }
+        for k, v := range raw {
+            if v[0] == "" || v[1] == "" { continue }
 
-        if len(r.Exchanges) >= 1 {
-            rs = append(rs, r)
+            var val ExchangeVolumeHistoryRecord
+            val.VolumeBTC, err = ParseDecimal(v[0])
+            if err != nil { return err }
+            val.VolumePercent, err = ParseDecimal(v[1])
+            if err != nil { return err }
+            if val.VolumeBTC.IsZero() && val.VolumePercent.IsZero() { continue }
+
+            r.Exchanges[k] = val
         }
-    }
 
-    return rs, nil
+        if len(r.Exchanges) == 0 { return nil }
+        return fn(r)
+    })
 }
 
-func (c *ApiClient) csvCall(endpoint string) ([]string, [][]string, error) {
+// csvEach streams a CSV endpoint, calling fn with the header and each record
+// in turn. StopIteration from fn ends the stream early, without error.
+func (c *ApiClient) csvEach(ctx context.Context, endpoint string, fn func(header, record []string) error) error {
     // Fetch CSV
-    data, err := c.apiCall(endpoint)
-    if err != nil { return nil, nil, err }
+    body, err := c.stream(ctx, endpoint)
+    if err != nil { return err }
+    defer body.Close()
 
     // Initialize CSV reader
-    stream := bytes.NewReader(data)
-    reader := csv.NewReader(stream)
+    reader := csv.NewReader(body)
 
     // Get CSV header
     var header []string
     header, err = reader.Read()
-    if err != nil { return nil, nil, err }
+    if err == io.EOF { return nil }
+    if err != nil { return err }
+
+    // Get CSV records, one at a time
+    for {
+        record, err := reader.Read()
+        if err == io.EOF { return nil }
+        if err != nil { return err }
+
+        err = fn(header, record)
+        if err == StopIteration { return nil }
+        if err != nil { return err }
+    }
+}
 
-    // Get CSV records
-    var records [][]string
-    records, err = reader.ReadAll()
-    if err != nil { return nil, nil, err }
+func (c *ApiClient) Ignored() (map[string]string, error) {
+    return c.IgnoredContext(context.Background())
+}
+
+func (c *ApiClient) IgnoredContext(ctx context.Context) (map[string]string, error) {
+    v, err := c.shared(ctx, "Ignored", func(ctx context.Context) (interface{}, error) {
+        data, err := c.apiCall(ctx, "ignored")
+        if err != nil { return nil, err }
+
+        var im map[string]string
+        err = json.Unmarshal(data, &im)
+        if err != nil { return nil, err }
 
-    return header, records, nil
+        return im, nil
+    })
+    if err != nil { return nil, err }
+    return v.(map[string]string), nil
+}
+
+func (c *ApiClient) apiCall(ctx context.Context, endpoint string) ([]byte, error) {
+    // Serve fresh cache entries straight away, keep stale ones around for
+    // revalidation.
+    var cached *CacheEntry
+    if c.cache != nil {
+        if e, ok := c.cache.Get(endpoint); ok {
+            if time.Now().Before(e.Expires) {
+                atomic.AddInt64(&c.stats.Hits, 1)
+                return e.Body, nil
+            }
+            cached = e
+        }
+    }
+
+    resp, err := c.fetch(ctx, endpoint, cached)
+    if err != nil { return nil, err }
+    if c.cache == nil { return resp.body, nil }
+
+    ttl := c.cacheTTL(endpoint)
+    if resp.notModified {
+        atomic.AddInt64(&c.stats.Revalidations, 1)
+        e := *cached
+        e.Expires = time.Now().Add(ttl)
+        c.cache.Set(endpoint, &e)
+        return e.Body, nil
+    }
+
+    atomic.AddInt64(&c.stats.Misses, 1)
+    if ttl > 0 {
+        c.cache.Set(endpoint, &CacheEntry{
+            Body:         resp.body,
+            ETag:         resp.header.Get("ETag"),
+            LastModified: resp.header.Get("Last-Modified"),
+            Expires:      time.Now().Add(ttl),
+        })
+    }
+    return resp.body, nil
 }
 
-func (c *ApiClient) Ignored() (map[string]string, error) {
-    data, err := c.apiCall("ignored")
+type response struct {
+    body        []byte
+    header      http.Header
+    notModified bool
+}
+
+// fetch performs the request for endpoint and reads the whole response.
+func (c *ApiClient) fetch(ctx context.Context, endpoint string, cached *CacheEntry) (*response, error) {
+    var r *response
+    err := c.withAttempts(ctx, endpoint, func() (int, error) {
+        resp, err := c.send(ctx, endpoint, cached)
+        if err != nil { return 0, err }
+        defer resp.Body.Close()
+
+        // Our cached copy is still good
+        if resp.StatusCode == http.StatusNotModified {
+            r = &response{header: resp.Header, notModified: true}
+            return resp.StatusCode, nil
+        }
+
+        // Retrieve raw JSON response
+        body, err := ioutil.ReadAll(resp.Body)
+        if err != nil { return resp.StatusCode, err }
+
+        r = &response{body: body, header: resp.Header}
+        return resp.StatusCode, nil
+    })
     if err != nil { return nil, err }
+    return r, nil
+}
+
+// stream performs the request for endpoint and hands back the response body
+// unread. Clients with a cache need the whole response anyway, so for them
+// it is read into memory first.
+func (c *ApiClient) stream(ctx context.Context, endpoint string) (io.ReadCloser, error) {
+    if c.cache != nil {
+        data, err := c.apiCall(ctx, endpoint)
+        if err != nil { return nil, err }
+        return ioutil.NopCloser(bytes.NewReader(data)), nil
+    }
 
-    var im map[string]string
-    err = json.Unmarshal(data, &im)
+    var body io.ReadCloser
+    err := c.withAttempts(ctx, endpoint, func() (int, error) {
+        resp, err := c.send(ctx, endpoint, nil)
+        if err != nil { return 0, err }
+        body = resp.Body
+        return resp.StatusCode, nil
+    })
     if err != nil { return nil, err }
+    return body, nil
+}
+
+// withAttempts runs fn through the rate limiter and the retry policy.
+func (c *ApiClient) withAttempts(ctx context.Context, endpoint string, fn func() (int, error)) error {
+    class := classify(endpoint)
+    return c.retry.withRetries(ctx, endpoint, func() (int, error) {
+        if c.limiter != nil {
+            err := c.limiter.Wait(ctx, class)
+            if err != nil { return 0, err }
+        }
 
-    return im, nil
+        status, err := fn()
+        if c.limiter != nil {
+            if errors.Is(err, ErrRateLimited) {
+                c.limiter.throttle(class)
+            } else if err == nil {
+                c.limiter.recover(class)
+            }
+        }
+        return status, err
+    })
 }
 
-func (c *ApiClient) apiCall(endpoint string) ([]byte, error) {
+// send makes a single request for endpoint, conditional if cached is set.
+// The response is returned with its body unread if the status is 200, or 304
+// for conditional requests; any other status is turned into an *APIError.
+func (c *ApiClient) send(ctx context.Context, endpoint string, cached *CacheEntry) (*http.Response, error) {
     // Build URL
     url := fmt.Sprintf("%v/%v", c.url, endpoint)
 
-    // Make request
-    resp, err := http.Get(url)
+    // Build request, bound to the caller's context so that deadlines and
+    // cancellation reach the transport.
+    req, err := http.NewRequest("GET", url, nil)
     if err != nil { return nil, err }
+    req = req.WithContext(ctx)
+    for k, v := range c.headers {
+        req.Header[k] = append([]string(nil), v...)
+    }
+    if cached != nil {
+        if cached.ETag != "" { req.Header.Set("If-None-Match", cached.ETag) }
+        if cached.LastModified != "" { req.Header.Set("If-Modified-Since", cached.LastModified) }
+    }
 
-    // Retrieve raw JSON response
-    var body []byte
-    body, err = ioutil.ReadAll(resp.Body)
+    // Make request
+    resp, err := c.client.Do(req)
     if err != nil { return nil, err }
-    defer resp.Body.Close()
 
-    // Process API-level error conditions
-    if resp.StatusCode != 200 {
-        return nil, errors.New(string(body))
+    if resp.StatusCode == 200 || (cached != nil && resp.StatusCode == http.StatusNotModified) {
+        return resp, nil
     }
 
-    return body, nil
+    // Process API-level error conditions
+    defer resp.Body.Close()
+    body, err := ioutil.ReadAll(resp.Body)
+    if err != nil { return nil, err }
+    return nil, newAPIError(endpoint, resp, body)
 }
@@ -1,7 +1,468 @@
-package bapi
+package bapi_test
 
-import "testing"
+import (
+    "context"
+    "net/http"
+    "reflect"
+    "errors"
+    "sort"
+    "testing"
+    "time"
 
-func TestImplementMe(t *testing.T) {
-    t.Errorf("Implement me, bitch.")
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func dec(s string) bapi.Decimal {
+    return bapi.MustParseDecimal(s)
+}
+
+func ts(s string) time.Time {
+    t, err := bapi.ParseTime(s)
+    if err != nil { panic(err) }
+    return t
+}
+
+func checkDecimals(t *testing.T, what string, got, want []bapi.Decimal) {
+    t.Helper()
+    for i := range want {
+        if !got[i].Equal(want[i]) {
+            t.Errorf("%v[%v]: got %v, want %v", what, i, got[i], want[i])
+        }
+    }
+}
+
+func TestIndexes(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    tests := []struct {
+        name    string
+        fn      func() ([]string, error)
+        want    []string
+    }{
+        {"GlobalTickerList", c.GlobalTickerList, []string{"EUR", "GBP", "USD"}},
+        {"MarketTickerList", c.MarketTickerList, []string{"EUR", "GBP", "USD"}},
+        {"ExchangeList", c.ExchangeList, []string{"EUR", "USD"}},
+        // The history index has no "all" entry, nothing must be dropped.
+        {"HistoryList", c.HistoryList, []string{"EUR", "USD"}},
+    }
+
+    for _, tt := range tests {
+        got, err := tt.fn()
+        if err != nil {
+            t.Errorf("%v: %v", tt.name, err)
+            continue
+        }
+        sort.Strings(got)
+        if !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%v: got %q, want %q", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestGlobalTicker(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    tk, err := c.GlobalTicker("USD")
+    if err != nil { t.Fatal(err) }
+
+    checkDecimals(t, "ticker",
+        []bapi.Decimal{tk.Average24h, tk.Ask, tk.Bid, tk.Last, tk.VolumeBTC, tk.VolumePercent},
+        []bapi.Decimal{dec("327.65"), dec("330.17"), dec("329.66"), dec("329.97"), dec("48203.11"), dec("72.34")})
+    if want := time.Date(2014, 11, 4, 14, 22, 3, 0, time.UTC); !tk.Timestamp.Equal(want) {
+        t.Errorf("Timestamp: got %v, want %v", tk.Timestamp, want)
+    }
+    if !tk.TotalVolume.IsZero() {
+        t.Errorf("TotalVolume: got %v for a global ticker", tk.TotalVolume)
+    }
+}
+
+func TestMarketTicker(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    tk, err := c.MarketTicker("EUR")
+    if err != nil { t.Fatal(err) }
+
+    checkDecimals(t, "ticker",
+        []bapi.Decimal{tk.Average24h, tk.Ask, tk.Bid, tk.Last, tk.TotalVolume},
+        []bapi.Decimal{dec("262.4"), dec("264.35"), dec("263.6"), dec("263.9"), dec("6998.2")})
+}
+
+func TestTickers(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    // Tickers carry timestamps of their own, apart from the snapshot's.
+    srv.SetFixture("ticker/global/all", []byte(`{
+  "EUR": {"last": 263.95, "timestamp": "Tue, 04 Nov 2014 14:22:01 -0000"},
+  "USD": {"last": 329.97, "timestamp": "Tue, 04 Nov 2014 14:22:02 -0000"},
+  "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000"
+}`))
+    at, err := c.GlobalTickers()
+    if err != nil { t.Fatal(err) }
+
+    // The snapshot timestamp is split off the ticker map.
+    if _, ok := at.Tickers["timestamp"]; ok {
+        t.Error("timestamp ended up in the ticker map")
+    }
+    if len(at.Tickers) != 2 {
+        t.Errorf("got %v tickers, want 2", len(at.Tickers))
+    }
+    if want := ts("Tue, 04 Nov 2014 14:22:03 -0000"); !at.Timestamp.Equal(want) {
+        t.Errorf("Timestamp: got %v, want %v", at.Timestamp, want)
+    }
+    if want := ts("Tue, 04 Nov 2014 14:22:01 -0000"); !at.Tickers["EUR"].Timestamp.Equal(want) {
+        t.Errorf("EUR Timestamp: got %v, want %v", at.Tickers["EUR"].Timestamp, want)
+    }
+    if !at.Tickers["USD"].Last.Equal(dec("329.97")) {
+        t.Errorf("USD Last: got %v", at.Tickers["USD"].Last)
+    }
+    if !at.Tickers["USD"].Average24h.IsZero() {
+        t.Errorf("USD Average24h: got %v, bulk tickers don't have it", at.Tickers["USD"].Average24h)
+    }
+
+    at, err = c.MarketTickers()
+    if err != nil { t.Fatal(err) }
+    if len(at.Tickers) != 3 || !at.Tickers["USD"].TotalVolume.Equal(dec("45230.42")) {
+        t.Errorf("unexpected market tickers: %+v", at.Tickers)
+    }
+    if want := ts("Tue, 04 Nov 2014 14:22:03 -0000"); !at.Timestamp.Equal(want) {
+        t.Errorf("Timestamp: got %v, want %v", at.Timestamp, want)
+    }
+}
+
+func TestExchanges(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    el, err := c.Exchanges("USD")
+    if err != nil { t.Fatal(err) }
+
+    if len(el.Exchanges) != 3 || el.Timestamp.IsZero() {
+        t.Fatalf("unexpected exchange list: %+v", el)
+    }
+    e := el.Exchanges["bitstamp"]
+    if e.DisplayName != "Bitstamp" || e.DisplayURL != "https://bitstamp.net" || e.Source != "api" {
+        t.Errorf("unexpected bitstamp: %+v", e)
+    }
+    checkDecimals(t, "bitstamp",
+        []bapi.Decimal{e.Rates.Ask, e.Rates.Bid, e.Rates.Last, e.VolumeBTC, e.VolumePercent},
+        []bapi.Decimal{dec("330.05"), dec("329.61"), dec("329.9"), dec("15420.02"), dec("34.09")})
+}
+
+func TestAllExchanges(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    ae, err := c.AllExchanges()
+    if err != nil { t.Fatal(err) }
+
+    if len(ae.Exchanges) != 2 || len(ae.Exchanges["USD"]) != 3 || len(ae.Exchanges["EUR"]) != 2 {
+        t.Fatalf("unexpected exchanges: %+v", ae.Exchanges)
+    }
+    if !ae.Exchanges["EUR"]["kraken"].Rates.Last.Equal(dec("263.93")) {
+        t.Errorf("kraken: got %+v", ae.Exchanges["EUR"]["kraken"])
+    }
+    if ae.Timestamp.IsZero() {
+        t.Error("Timestamp not set")
+    }
+}
+
+func TestMinutelyHistory(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    rs, err := c.MinutelyHistory("USD")
+    if err != nil { t.Fatal(err) }
+
+    if len(rs) != 7 {
+        t.Fatalf("got %v records, want 7", len(rs))
+    }
+    if want := time.Date(2014, 11, 4, 14, 15, 0, 0, time.UTC); !rs[0].DateTime.Equal(want) {
+        t.Errorf("DateTime: got %v, want %v", rs[0].DateTime, want)
+    }
+    checkDecimals(t, "average",
+        []bapi.Decimal{rs[0].Average, rs[1].Average, rs[6].Average},
+        []bapi.Decimal{dec("329.41"), dec("329.58"), dec("329.96")})
+}
+
+func TestHourlyHistory(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    rs, err := c.HourlyHistory("USD")
+    if err != nil { t.Fatal(err) }
+
+    if len(rs) != 5 {
+        t.Fatalf("got %v records, want 5", len(rs))
+    }
+    checkDecimals(t, "record",
+        []bapi.Decimal{rs[4].High, rs[4].Low, rs[4].Average},
+        []bapi.Decimal{dec("330.4"), dec("328.2"), dec("329.26")})
+}
+
+func TestDailyHistory(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    rs, err := c.DailyHistory("USD")
+    if err != nil { t.Fatal(err) }
+
+    if len(rs) != 6 {
+        t.Fatalf("got %v records, want 6", len(rs))
+    }
+    if want := time.Date(2014, 10, 29, 0, 0, 0, 0, time.UTC); !rs[0].DateTime.Equal(want) {
+        t.Errorf("DateTime: got %v, want %v", rs[0].DateTime, want)
+    }
+    checkDecimals(t, "record",
+        []bapi.Decimal{rs[0].High, rs[0].Low, rs[0].Average, rs[0].Volume},
+        []bapi.Decimal{dec("358.12"), dec("351.4"), dec("354.51"), dec("41012.31")})
+}
+
+func TestVolumeHistoryFiltersBogusData(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    srv.SetFixture("history/USD/volumes.csv", []byte(`datetime,total_vol,bitstamp BTC,bitstamp %,btce BTC,btce %,mtgox BTC,mtgox %
+2014-02-24 00:00:00,30120.5,12010.2,39.87,9110.3,30.25,9000.0,29.88
+2014-11-01 00:00:00,21797.67,13811.6,63.36,7986.07,36.64,,
+2014-11-02 00:00:00,14671.9,9771.0,66.6,4900.9,33.4,0,0
+2014-11-03 00:00:00,0,0,0,,,0,0
+`))
+    rs, err := c.VolumeHistory("USD")
+    if err != nil { t.Fatal(err) }
+
+    // Exchanges with missing or all-zero figures are dropped, and so are
+    // rows left without any exchange.
+    want := [][]string{
+        {"bitstamp", "btce", "mtgox"},
+        {"bitstamp", "btce"},
+        {"bitstamp", "btce"},
+    }
+    if len(rs) != len(want) {
+        t.Fatalf("got %v records, want %v", len(rs), len(want))
+    }
+    for i, r := range rs {
+        var got []string
+        for k := range r.Exchanges {
+            got = append(got, k)
+        }
+        sort.Strings(got)
+        if !reflect.DeepEqual(got, want[i]) {
+            t.Errorf("record %v: got exchanges %q, want %q", i, got, want[i])
+        }
+    }
+
+    if !rs[1].TotalVolume.Equal(dec("21797.67")) {
+        t.Errorf("TotalVolume: got %v", rs[1].TotalVolume)
+    }
+    v := rs[1].Exchanges["btce"]
+    if !v.VolumeBTC.Equal(dec("7986.07")) || !v.VolumePercent.Equal(dec("36.64")) {
+        t.Errorf("btce: got %+v", v)
+    }
+}
+
+func TestHistoryRejectsUnexpectedColumns(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    srv.SetFixture("history/BAD/per_minute_24h_sliding_window.csv", []byte("datetime,average,median\n2014-11-04 14:19:00,329.9,329.8\n"))
+    srv.SetFixture("history/BAD/per_hour_monthly_sliding_window.csv", []byte("datetime,high,low,average,open\n2014-11-04 12:00:00,329.0,327.05,328.13,328.0\n"))
+    srv.SetFixture("history/BAD/per_day_all_time_history.csv", []byte("datetime,high,low,average,volume,vwap\n2014-11-02 00:00:00,328.7,320.9,324.81,27640.4,324.7\n"))
+    srv.SetFixture("history/BAD/volumes.csv", []byte("datetime,total_vol,bitstamp\n2014-11-01 00:00:00,21797.67,13811.6\n"))
+
+    tests := []struct {
+        name    string
+        fn      func(string) error
+        want    string
+    }{
+        {"MinutelyHistory", func(s string) error { _, err := c.MinutelyHistory(s); return err }, "got unexpected CSV columns."},
+        {"HourlyHistory", func(s string) error { _, err := c.HourlyHistory(s); return err }, "got unexpected CSV columns."},
+        {"DailyHistory", func(s string) error { _, err := c.DailyHistory(s); return err }, "got unexpected CSV columns."},
+        {"VolumeHistory", func(s string) error { _, err := c.VolumeHistory(s); return err }, "got malformed CSV data."},
+    }
+
+    for _, tt := range tests {
+        err := tt.fn("BAD")
+        if err == nil || err.Error() != tt.want {
+            t.Errorf("%v: got error %v, want %q", tt.name, err, tt.want)
+        }
+    }
+}
+
+func TestIgnored(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    im, err := c.Ignored()
+    if err != nil { t.Fatal(err) }
+
+    want := map[string]string{
+        "bitcurex":    "bitcurex.com query fail",
+        "justcoin":    "api.justcoin.com query fail",
+        "rocktrading": "Volume data not available",
+    }
+    if !reflect.DeepEqual(im, want) {
+        t.Errorf("got %q, want %q", im, want)
+    }
+}
+
+func TestAPIError(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    _, err := c.GlobalTicker("XYZ")
+    if !errors.Is(err, bapi.ErrUnknownSymbol) {
+        t.Fatalf("got %v, want ErrUnknownSymbol", err)
+    }
+
+    var apiErr *bapi.APIError
+    if !errors.As(err, &apiErr) {
+        t.Fatalf("got %T, want *APIError", err)
+    }
+    if apiErr.StatusCode != 404 || apiErr.Endpoint != "ticker/global/XYZ" || apiErr.Message != "Unknown symbol or endpoint." {
+        t.Errorf("unexpected error: %+v", apiErr)
+    }
+    if errors.Is(err, bapi.ErrRateLimited) || errors.Is(err, bapi.ErrServerUnavailable) {
+        t.Error("404 matched the wrong sentinel")
+    }
+
+    srv.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+        w.Header().Set("Retry-After", "30")
+        w.WriteHeader(http.StatusTooManyRequests)
+        w.Write([]byte(`{"message": "Slow down."}`))
+        return true
+    })
+    _, err = c.GlobalTicker("USD")
+    if !errors.As(err, &apiErr) || !errors.Is(err, bapi.ErrRateLimited) {
+        t.Fatalf("got %v, want a rate limiting *APIError", err)
+    }
+    if apiErr.RetryAfter != 30 * time.Second || apiErr.Message != "Slow down." {
+        t.Errorf("unexpected error: %+v", apiErr)
+    }
+}
+
+func TestContextCancellation(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+
+    release := make(chan struct{})
+    defer close(release)
+    srv.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+        select {
+        case <-release:
+        case <-r.Context().Done():
+        }
+        return true
+    })
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+    defer cancel()
+    _, err := c.GlobalTickersContext(ctx)
+    if !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("got %v, want context.DeadlineExceeded", err)
+    }
+}
+
+func TestOptions(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    var seen []string
+    mw := func(name string) bapi.Middleware {
+        return func(next http.RoundTripper) http.RoundTripper {
+            return bapi.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+                seen = append(seen, name)
+                return next.RoundTrip(req)
+            })
+        }
+    }
+    c := bapi.NewWithOptions(srv.URL,
+        bapi.WithHTTPClient(&http.Client{Timeout: time.Second}),
+        bapi.WithHeader("X-Api-Key", "secret"),
+        bapi.WithMiddleware(mw("outer"), mw("inner")))
+
+    _, err := c.Ignored()
+    if err != nil { t.Fatal(err) }
+
+    if !reflect.DeepEqual(seen, []string{"outer", "inner"}) {
+        t.Errorf("middleware ran as %q", seen)
+    }
+    if got := srv.Requests()[0].Header.Get("X-Api-Key"); got != "secret" {
+        t.Errorf("X-Api-Key: got %q", got)
+    }
+}
+
+func TestCachedClient(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    var c bapi.Client = bapi.NewCachedClient(bapi.NewWithOptions(srv.URL), time.Hour)
+    for i := 0; i < 3; i++ {
+        if _, err := c.GlobalTicker("USD"); err != nil { t.Fatal(err) }
+        if _, err := c.DailyHistory("USD"); err != nil { t.Fatal(err) }
+    }
+    if got := len(srv.Requests()); got != 2 {
+        t.Errorf("got %v requests, want 2", got)
+    }
+
+    // Errors are not memoized.
+    for i := 0; i < 2; i++ {
+        if _, err := c.GlobalTicker("XXX"); !errors.Is(err, bapi.ErrUnknownSymbol) {
+            t.Fatalf("got %v, want ErrUnknownSymbol", err)
+        }
+    }
+    if got := len(srv.Requests()); got != 4 {
+        t.Errorf("got %v requests, want 4", got)
+    }
+
+    c.(*bapi.CachedClient).Purge()
+    if _, err := c.GlobalTicker("USD"); err != nil { t.Fatal(err) }
+    if got := len(srv.Requests()); got != 5 {
+        t.Errorf("got %v requests after Purge, want 5", got)
+    }
+}
+
+func TestHistoryEach(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+    c := bapi.NewWithOptions(srv.URL)
+    ctx := context.Background()
+
+    var got []bapi.DailyHistoryRecord
+    err := c.DailyHistoryEach(ctx, "USD", func(r bapi.DailyHistoryRecord) error {
+        got = append(got, r)
+        return bapi.StopIteration
+    })
+    if err != nil || len(got) != 1 || !got[0].Average.Equal(dec("354.51")) {
+        t.Errorf("early stop: got %+v, %v", got, err)
+    }
+
+    boom := errors.New("boom")
+    n := 0
+    err = c.VolumeHistoryEach(ctx, "USD", func(r bapi.VolumeHistoryRecord) error {
+        n++
+        if n == 2 { return boom }
+        return nil
+    })
+    if err != boom || n != 2 {
+        t.Errorf("callback error: got %v after %v records", err, n)
+    }
 }
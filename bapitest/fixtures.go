@@ -0,0 +1,308 @@
+package bapitest
+
+// DefaultFixtures returns a fresh copy of the fixtures a new Server starts
+// with. They cover every endpoint used by bapi.ApiClient for USD and EUR,
+// plus the GBP tickers, as captured from the live API on 2014-11-04.
+func DefaultFixtures() map[string][]byte {
+    m := make(map[string][]byte, len(defaultFixtures))
+    for k, v := range defaultFixtures {
+        m[k] = []byte(v)
+    }
+    return m
+}
+
+var defaultFixtures = map[string]string{
+    "ticker/global/": `{
+  "EUR": "https://api.bitcoinaverage.com/ticker/global/EUR",
+  "GBP": "https://api.bitcoinaverage.com/ticker/global/GBP",
+  "USD": "https://api.bitcoinaverage.com/ticker/global/USD",
+  "all": "https://api.bitcoinaverage.com/ticker/global/all"
+}`,
+
+    "ticker/global/USD": `{
+  "24h_avg": 327.65,
+  "ask": 330.17,
+  "bid": 329.66,
+  "last": 329.97,
+  "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000",
+  "volume_btc": 48203.11,
+  "volume_percent": 72.34
+}`,
+
+    "ticker/global/EUR": `{
+  "24h_avg": 262.32,
+  "ask": 264.3,
+  "bid": 263.61,
+  "last": 263.95,
+  "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000",
+  "volume_btc": 7341.5,
+  "volume_percent": 11.02
+}`,
+
+    "ticker/global/GBP": `{
+  "24h_avg": 205.11,
+  "ask": 206.63,
+  "bid": 206.12,
+  "last": 206.4,
+  "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000",
+  "volume_btc": 1023.86,
+  "volume_percent": 1.54
+}`,
+
+    "ticker/global/all": `{
+  "EUR": {
+    "ask": 264.3,
+    "bid": 263.61,
+    "last": 263.95,
+    "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000",
+    "volume_btc": 7341.5,
+    "volume_percent": 11.02
+  },
+  "GBP": {
+    "ask": 206.63,
+    "bid": 206.12,
+    "last": 206.4,
+    "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000",
+    "volume_btc": 1023.86,
+    "volume_percent": 1.54
+  },
+  "USD": {
+    "ask": 330.17,
+    "bid": 329.66,
+    "last": 329.97,
+    "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000",
+    "volume_btc": 48203.11,
+    "volume_percent": 72.34
+  },
+  "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000"
+}`,
+
+    "ticker/": `{
+  "EUR": "https://api.bitcoinaverage.com/ticker/EUR",
+  "GBP": "https://api.bitcoinaverage.com/ticker/GBP",
+  "USD": "https://api.bitcoinaverage.com/ticker/USD",
+  "all": "https://api.bitcoinaverage.com/ticker/all"
+}`,
+
+    "ticker/USD": `{
+  "24h_avg": 327.81,
+  "ask": 330.2,
+  "bid": 329.7,
+  "last": 330.01,
+  "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000",
+  "total_vol": 45230.42
+}`,
+
+    "ticker/EUR": `{
+  "24h_avg": 262.4,
+  "ask": 264.35,
+  "bid": 263.6,
+  "last": 263.9,
+  "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000",
+  "total_vol": 6998.2
+}`,
+
+    "ticker/GBP": `{
+  "24h_avg": 205.2,
+  "ask": 206.7,
+  "bid": 206.1,
+  "last": 206.45,
+  "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000",
+  "total_vol": 987.36
+}`,
+
+    "ticker/all": `{
+  "EUR": {
+    "24h_avg": 262.4,
+    "ask": 264.35,
+    "bid": 263.6,
+    "last": 263.9,
+    "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000",
+    "total_vol": 6998.2
+  },
+  "GBP": {
+    "24h_avg": 205.2,
+    "ask": 206.7,
+    "bid": 206.1,
+    "last": 206.45,
+    "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000",
+    "total_vol": 987.36
+  },
+  "USD": {
+    "24h_avg": 327.81,
+    "ask": 330.2,
+    "bid": 329.7,
+    "last": 330.01,
+    "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000",
+    "total_vol": 45230.42
+  },
+  "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000"
+}`,
+
+    "exchanges/": `{
+  "EUR": "https://api.bitcoinaverage.com/exchanges/EUR",
+  "USD": "https://api.bitcoinaverage.com/exchanges/USD",
+  "all": "https://api.bitcoinaverage.com/exchanges/all"
+}`,
+
+    "exchanges/USD": `{
+  "bitfinex": {
+    "display_URL": "https://www.bitfinex.com",
+    "display_name": "Bitfinex",
+    "rates": {"ask": 330.3, "bid": 329.8, "last": 330.1},
+    "source": "api",
+    "volume_btc": 21530.28,
+    "volume_percent": 47.6
+  },
+  "bitstamp": {
+    "display_URL": "https://bitstamp.net",
+    "display_name": "Bitstamp",
+    "rates": {"ask": 330.05, "bid": 329.61, "last": 329.9},
+    "source": "api",
+    "volume_btc": 15420.02,
+    "volume_percent": 34.09
+  },
+  "btce": {
+    "display_URL": "https://btc-e.com",
+    "display_name": "BTC-e",
+    "rates": {"ask": 329.5, "bid": 328.7, "last": 329.2},
+    "source": "api",
+    "volume_btc": 8280.12,
+    "volume_percent": 18.31
+  },
+  "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000"
+}`,
+
+    "exchanges/EUR": `{
+  "btce": {
+    "display_URL": "https://btc-e.com",
+    "display_name": "BTC-e",
+    "rates": {"ask": 265.1, "bid": 263.2, "last": 264.0},
+    "source": "api",
+    "volume_btc": 1210.44,
+    "volume_percent": 17.3
+  },
+  "kraken": {
+    "display_URL": "https://kraken.com",
+    "display_name": "Kraken",
+    "rates": {"ask": 264.2, "bid": 263.7, "last": 263.93},
+    "source": "api",
+    "volume_btc": 5785.76,
+    "volume_percent": 82.7
+  },
+  "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000"
+}`,
+
+    "exchanges/all": `{
+  "EUR": {
+    "btce": {
+      "display_URL": "https://btc-e.com",
+      "display_name": "BTC-e",
+      "rates": {"ask": 265.1, "bid": 263.2, "last": 264.0},
+      "source": "api",
+      "volume_btc": 1210.44,
+      "volume_percent": 17.3
+    },
+    "kraken": {
+      "display_URL": "https://kraken.com",
+      "display_name": "Kraken",
+      "rates": {"ask": 264.2, "bid": 263.7, "last": 263.93},
+      "source": "api",
+      "volume_btc": 5785.76,
+      "volume_percent": 82.7
+    }
+  },
+  "USD": {
+    "bitfinex": {
+      "display_URL": "https://www.bitfinex.com",
+      "display_name": "Bitfinex",
+      "rates": {"ask": 330.3, "bid": 329.8, "last": 330.1},
+      "source": "api",
+      "volume_btc": 21530.28,
+      "volume_percent": 47.6
+    },
+    "bitstamp": {
+      "display_URL": "https://bitstamp.net",
+      "display_name": "Bitstamp",
+      "rates": {"ask": 330.05, "bid": 329.61, "last": 329.9},
+      "source": "api",
+      "volume_btc": 15420.02,
+      "volume_percent": 34.09
+    },
+    "btce": {
+      "display_URL": "https://btc-e.com",
+      "display_name": "BTC-e",
+      "rates": {"ask": 329.5, "bid": 328.7, "last": 329.2},
+      "source": "api",
+      "volume_btc": 8280.12,
+      "volume_percent": 18.31
+    }
+  },
+  "timestamp": "Tue, 04 Nov 2014 14:22:03 -0000"
+}`,
+
+    "history/": `{
+  "EUR": "https://api.bitcoinaverage.com/history/EUR/",
+  "USD": "https://api.bitcoinaverage.com/history/USD/"
+}`,
+
+    "history/USD/per_minute_24h_sliding_window.csv": `datetime,average
+2014-11-04 14:15:00,329.41
+2014-11-04 14:16:00,329.58
+2014-11-04 14:17:00,329.62
+2014-11-04 14:18:00,329.77
+2014-11-04 14:19:00,329.9
+2014-11-04 14:20:00,329.85
+2014-11-04 14:21:00,329.96
+`,
+
+    "history/EUR/per_minute_24h_sliding_window.csv": `datetime,average
+2014-11-04 14:19:00,263.71
+2014-11-04 14:20:00,263.8
+2014-11-04 14:21:00,263.92
+`,
+
+    "history/USD/per_hour_monthly_sliding_window.csv": `datetime,high,low,average
+2014-11-04 09:00:00,326.4,323.8,325.02
+2014-11-04 10:00:00,327.1,324.9,326.11
+2014-11-04 11:00:00,328.3,326.2,327.4
+2014-11-04 12:00:00,329.0,327.05,328.13
+2014-11-04 13:00:00,330.4,328.2,329.26
+`,
+
+    "history/EUR/per_hour_monthly_sliding_window.csv": `datetime,high,low,average
+2014-11-04 12:00:00,263.3,261.9,262.7
+2014-11-04 13:00:00,264.5,262.8,263.55
+`,
+
+    "history/USD/per_day_all_time_history.csv": `datetime,high,low,average,volume
+2014-10-29 00:00:00,358.12,351.4,354.51,41012.31
+2014-10-30 00:00:00,345.9,339.02,342.77,52830.9
+2014-10-31 00:00:00,343.81,334.2,338.3,48222.05
+2014-11-01 00:00:00,337.42,321.4,327.66,39018.77
+2014-11-02 00:00:00,328.7,320.9,324.81,27640.4
+2014-11-03 00:00:00,331.35,321.01,326.42,44810.68
+`,
+
+    "history/EUR/per_day_all_time_history.csv": `datetime,high,low,average,volume
+2014-11-02 00:00:00,263.1,256.2,259.8,6120.3
+2014-11-03 00:00:00,265.2,257.1,261.44,7021.9
+`,
+
+    "history/USD/volumes.csv": `datetime,total_vol,bitfinex BTC,bitfinex %,bitstamp BTC,bitstamp %,btce BTC,btce %
+2014-11-01 00:00:00,39018.77,18220.1,46.7,13811.6,35.4,6987.07,17.9
+2014-11-02 00:00:00,27640.4,12968.5,46.92,9771.0,35.35,4900.9,17.73
+2014-11-03 00:00:00,44810.68,21530.28,48.05,15420.02,34.41,7860.38,17.54
+`,
+
+    "history/EUR/volumes.csv": `datetime,total_vol,btce BTC,btce %,kraken BTC,kraken %
+2014-11-02 00:00:00,6120.3,1102.1,18.01,5018.2,81.99
+2014-11-03 00:00:00,7021.9,1210.44,17.24,5811.46,82.76
+`,
+
+    "ignored": `{
+  "bitcurex": "bitcurex.com query fail",
+  "justcoin": "api.justcoin.com query fail",
+  "rocktrading": "Volume data not available"
+}`,
+}
@@ -0,0 +1,240 @@
+// Package bapitest provides a fake BitcoinAverage API server for testing
+// code that uses package bapi without touching the network.
+//
+// Point a client at it with bapi.NewWithOptions(srv.URL), or just use
+// srv.APIClient().
+package bapitest
+
+import (
+    "crypto/sha1"
+    "encoding/hex"
+    "net/http"
+    "net/http/httptest"
+    "io/ioutil"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+    "os"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+// Fault describes a failure to inject into the responses for an endpoint.
+type Fault struct {
+    // Latency delays the response.
+    Latency         time.Duration
+    // Status, if not zero, is sent instead of the fixture, along with Body.
+    Status          int
+    Body            string
+    // RetryAfter is sent as the Retry-After header when set.
+    RetryAfter      string
+    // Malformed corrupts the fixture so that it no longer parses.
+    Malformed       bool
+    // Truncate, if not zero, cuts the fixture short after that many bytes.
+    Truncate        int
+    // Times limits the fault to the next n requests. Zero means forever.
+    Times           int
+}
+
+// Request is a request received by the Server.
+type Request struct {
+    Method          string
+    // Endpoint is the path relative to the API root, e.g. "ticker/global/USD".
+    Endpoint        string
+    Header          http.Header
+    Time            time.Time
+}
+
+// Server is a fake BitcoinAverage API. It serves fixtures keyed by endpoint
+// (see DefaultFixtures), supports conditional requests through ETags, and
+// records every request it gets.
+type Server struct {
+    *httptest.Server
+
+    mu              sync.Mutex
+    fixtures        map[string][]byte
+    faults          map[string]*Fault
+    requests        []Request
+    intercept       func(w http.ResponseWriter, r *http.Request) bool
+}
+
+// NewServer starts a Server loaded with DefaultFixtures. Call Close when
+// done with it.
+func NewServer() *Server {
+    s := &Server{fixtures: DefaultFixtures(), faults: make(map[string]*Fault)}
+    s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+    return s
+}
+
+// APIClient returns a bapi.Client talking to the server. Options are passed
+// on to bapi.NewWithOptions. Client, from the embedded httptest.Server,
+// still returns the plain *http.Client.
+func (s *Server) APIClient(opts ...bapi.Option) bapi.Client {
+    return bapi.NewWithOptions(s.URL, opts...)
+}
+
+// SetFixture sets the response body for endpoint.
+func (s *Server) SetFixture(endpoint string, body []byte) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.fixtures[normalize(endpoint)] = body
+}
+
+// RemoveFixture makes endpoint answer 404.
+func (s *Server) RemoveFixture(endpoint string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    delete(s.fixtures, normalize(endpoint))
+}
+
+// LoadFixtures reads fixtures from the files under dir. A file's path
+// relative to dir is its endpoint, minus any .json extension; index.json
+// files stand for the index endpoints ending in a slash. For instance:
+//
+//     ticker/global/index.json                      -> ticker/global/
+//     ticker/global/USD.json                        -> ticker/global/USD
+//     history/USD/per_day_all_time_history.csv      -> (same)
+func (s *Server) LoadFixtures(dir string) error {
+    return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+        if err != nil || info.IsDir() { return err }
+
+        rel, err := filepath.Rel(dir, path)
+        if err != nil { return err }
+        data, err := ioutil.ReadFile(path)
+        if err != nil { return err }
+
+        endpoint := filepath.ToSlash(rel)
+        if filepath.Base(endpoint) == "index.json" {
+            endpoint = strings.TrimSuffix(endpoint, "index.json")
+        } else {
+            endpoint = strings.TrimSuffix(endpoint, ".json")
+        }
+        s.SetFixture(endpoint, data)
+        return nil
+    })
+}
+
+// SetFault injects f into the responses for endpoint. An empty endpoint
+// applies f to every endpoint without a fault of its own.
+func (s *Server) SetFault(endpoint string, f Fault) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.faults[normalize(endpoint)] = &f
+}
+
+// ClearFaults removes every injected fault.
+func (s *Server) ClearFaults() {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.faults = make(map[string]*Fault)
+}
+
+// Intercept gives fn first go at every request, after it is recorded. fn
+// reports whether it handled the request; if not, the request is served as
+// usual. It is meant for behaviour Faults can't describe, such as holding a
+// response until the test says so. A nil fn removes the interceptor.
+func (s *Server) Intercept(fn func(w http.ResponseWriter, r *http.Request) bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.intercept = fn
+}
+
+// Requests returns the requests received so far, oldest first.
+func (s *Server) Requests() []Request {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return append([]Request(nil), s.requests...)
+}
+
+// ResetRequests forgets the requests received so far.
+func (s *Server) ResetRequests() {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.requests = nil
+}
+
+func normalize(endpoint string) string {
+    return strings.TrimLeft(endpoint, "/")
+}
+
+// takeFault returns the fault to apply to endpoint, if any, and accounts for
+// its use.
+func (s *Server) takeFault(endpoint string) *Fault {
+    f, ok := s.faults[endpoint]
+    if !ok {
+        f, ok = s.faults[""]
+        endpoint = ""
+    }
+    if !ok { return nil }
+
+    if f.Times > 0 {
+        f.Times--
+        if f.Times == 0 { delete(s.faults, endpoint) }
+    }
+    cp := *f
+    return &cp
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+    endpoint := normalize(r.URL.Path)
+
+    s.mu.Lock()
+    s.requests = append(s.requests, Request{
+        Method:   r.Method,
+        Endpoint: endpoint,
+        Header:   r.Header.Clone(),
+        Time:     time.Now(),
+    })
+    intercept := s.intercept
+    s.mu.Unlock()
+    if intercept != nil && intercept(w, r) { return }
+
+    s.mu.Lock()
+    body, found := s.fixtures[endpoint]
+    fault := s.takeFault(endpoint)
+    s.mu.Unlock()
+
+    if fault != nil && fault.Latency > 0 {
+        select {
+        case <-time.After(fault.Latency):
+        case <-r.Context().Done():
+            return
+        }
+    }
+
+    if fault != nil && fault.Status != 0 {
+        if fault.RetryAfter != "" {
+            w.Header().Set("Retry-After", fault.RetryAfter)
+        }
+        w.WriteHeader(fault.Status)
+        w.Write([]byte(fault.Body))
+        return
+    }
+
+    if !found {
+        http.Error(w, "Unknown symbol or endpoint.", http.StatusNotFound)
+        return
+    }
+
+    if fault != nil && fault.Malformed {
+        body = append(append([]byte(nil), body[:len(body)/2]...), "\"<malformed"...)
+    }
+    if fault != nil && fault.Truncate > 0 && fault.Truncate < len(body) {
+        body = body[:fault.Truncate]
+    }
+
+    sum := sha1.Sum(body)
+    etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+    w.Header().Set("ETag", etag)
+    if strings.HasSuffix(endpoint, ".csv") {
+        w.Header().Set("Content-Type", "text/csv")
+    } else {
+        w.Header().Set("Content-Type", "application/json")
+    }
+    if r.Header.Get("If-None-Match") == etag {
+        w.WriteHeader(http.StatusNotModified)
+        return
+    }
+    w.Write(body)
+}
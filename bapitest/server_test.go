@@ -0,0 +1,166 @@
+package bapitest
+
+import (
+    "context"
+    "errors"
+    "io/ioutil"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+func get(t *testing.T, srv *Server, endpoint string) (int, string) {
+    resp, err := http.Get(srv.URL + "/" + endpoint)
+    if err != nil { t.Fatal(err) }
+    defer resp.Body.Close()
+
+    body, err := ioutil.ReadAll(resp.Body)
+    if err != nil { t.Fatal(err) }
+    return resp.StatusCode, string(body)
+}
+
+func TestServesFixtures(t *testing.T) {
+    srv := NewServer()
+    defer srv.Close()
+
+    for endpoint, want := range defaultFixtures {
+        status, body := get(t, srv, endpoint)
+        if status != 200 || body != want {
+            t.Errorf("%v: got %v %q", endpoint, status, body)
+        }
+    }
+
+    if status, _ := get(t, srv, "ticker/global/XYZ"); status != 404 {
+        t.Errorf("unknown endpoint: got status %v, want 404", status)
+    }
+}
+
+func TestFaults(t *testing.T) {
+    srv := NewServer()
+    defer srv.Close()
+
+    srv.SetFault("ticker/global/USD", Fault{Status: 502, Body: "Bad Gateway", Times: 1})
+    if status, _ := get(t, srv, "ticker/global/USD"); status != 502 {
+        t.Errorf("got status %v, want 502", status)
+    }
+    if status, _ := get(t, srv, "ticker/global/USD"); status != 200 {
+        t.Errorf("fault should have expired, got status %v", status)
+    }
+
+    srv.SetFault("history/USD/volumes.csv", Fault{Truncate: 10})
+    if _, body := get(t, srv, "history/USD/volumes.csv"); len(body) != 10 {
+        t.Errorf("got %v bytes, want 10", len(body))
+    }
+}
+
+func TestRecordsRequests(t *testing.T) {
+    srv := NewServer()
+    defer srv.Close()
+
+    get(t, srv, "ignored")
+    get(t, srv, "ticker/all")
+
+    reqs := srv.Requests()
+    if len(reqs) != 2 || reqs[0].Endpoint != "ignored" || reqs[1].Endpoint != "ticker/all" {
+        t.Errorf("unexpected requests: %+v", reqs)
+    }
+}
+
+func TestClientFaults(t *testing.T) {
+    srv := NewServer()
+    defer srv.Close()
+    c := srv.APIClient()
+
+    srv.SetFault("ticker/global/USD", Fault{Latency: time.Second})
+    ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Millisecond)
+    _, err := c.GlobalTickerContext(ctx, "USD")
+    cancel()
+    if !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("latency: got %v, want a deadline error", err)
+    }
+
+    srv.SetFault("ticker/global/USD", Fault{Status: 503, Body: `{"error": "Down for maintenance."}`, RetryAfter: "7"})
+    _, err = c.GlobalTicker("USD")
+    var apiErr *bapi.APIError
+    if !errors.Is(err, bapi.ErrServerUnavailable) || !errors.As(err, &apiErr) || apiErr.RetryAfter != 7 * time.Second {
+        t.Errorf("status: got %v, want a 503 with Retry-After", err)
+    }
+
+    srv.SetFault("ticker/global/USD", Fault{Status: 429})
+    if _, err = c.GlobalTicker("USD"); !errors.Is(err, bapi.ErrRateLimited) {
+        t.Errorf("429: got %v, want ErrRateLimited", err)
+    }
+
+    srv.RemoveFixture("ticker/global/EUR")
+    if _, err = c.GlobalTicker("EUR"); !errors.Is(err, bapi.ErrUnknownSymbol) {
+        t.Errorf("missing fixture: got %v, want ErrUnknownSymbol", err)
+    }
+
+    srv.ClearFaults()
+    srv.SetFault("ticker/global/USD", Fault{Malformed: true})
+    srv.SetFault("history/USD/per_day_all_time_history.csv", Fault{Malformed: true})
+    if _, err = c.GlobalTicker("USD"); err == nil || errors.As(err, &apiErr) {
+        t.Errorf("malformed JSON: got %v, want a decoding error", err)
+    }
+    if _, err = c.DailyHistory("USD"); err == nil || errors.As(err, &apiErr) {
+        t.Errorf("malformed CSV: got %v, want a decoding error", err)
+    }
+
+    // Cut the first record short.
+    srv.SetFault("history/USD/per_minute_24h_sliding_window.csv", Fault{Truncate: 30})
+    srv.SetFault("exchanges/USD", Fault{Truncate: 30})
+    if _, err = c.MinutelyHistory("USD"); err == nil {
+        t.Error("truncated CSV: expected an error")
+    }
+    if _, err = c.Exchanges("USD"); err == nil {
+        t.Error("truncated JSON: expected an error")
+    }
+}
+
+func TestClientRetriesThroughFaults(t *testing.T) {
+    srv := NewServer()
+    defer srv.Close()
+    c := srv.APIClient(bapi.WithRetryPolicy(bapi.RetryPolicy{
+        MaxAttempts:     3,
+        InitialBackoff:  time.Millisecond,
+        RetryableStatus: []int{502},
+    }))
+
+    srv.SetFault("ticker/global/USD", Fault{Status: 502, Times: 2})
+    tk, err := c.GlobalTicker("USD")
+    if err != nil { t.Fatal(err) }
+    if tk.Last.Sign() <= 0 {
+        t.Errorf("got %+v", tk)
+    }
+    if n := len(srv.Requests()); n != 3 {
+        t.Errorf("got %v requests, want 3", n)
+    }
+
+    srv.ResetRequests()
+    srv.SetFault("ticker/global/USD", Fault{Status: 502, Times: 3})
+    if _, err = c.GlobalTicker("USD"); !errors.Is(err, bapi.ErrServerUnavailable) {
+        t.Errorf("got %v, want the last 502", err)
+    }
+    if n := len(srv.Requests()); n != 3 {
+        t.Errorf("got %v requests, want 3", n)
+    }
+}
+
+func TestClientRevalidates(t *testing.T) {
+    srv := NewServer()
+    defer srv.Close()
+    c := srv.APIClient(bapi.WithCache(bapi.NewMemoryCache(10), func(string) time.Duration { return time.Nanosecond }))
+
+    for i := 0; i < 2; i++ {
+        if _, err := c.Ignored(); err != nil { t.Fatal(err) }
+    }
+    reqs := srv.Requests()
+    if len(reqs) != 2 || reqs[0].Header.Get("If-None-Match") != "" || reqs[1].Header.Get("If-None-Match") == "" {
+        t.Errorf("unexpected requests: %+v", reqs)
+    }
+    if got := c.(*bapi.ApiClient).CacheStats(); got.Revalidations != 1 {
+        t.Errorf("got %+v, want one revalidation", got)
+    }
+}
@@ -0,0 +1,247 @@
+// Package quality inspects bapi history series for the usual upstream
+// glitches (skipped rows, repeated or shuffled timestamps, blank or absurd
+// prices) and optionally repairs them.
+package quality
+
+import (
+    "sort"
+    "time"
+    "fmt"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+type IssueKind string
+
+const (
+    Gap             IssueKind = "gap"
+    Duplicate       IssueKind = "duplicate"
+    OutOfOrder      IssueKind = "out_of_order"
+    ZeroPrice       IssueKind = "zero_price"
+    NegativePrice   IssueKind = "negative_price"
+    Outlier         IssueKind = "outlier"
+)
+
+// Issue is a single problem found in a series. Index refers to the series as
+// given to Check.
+type Issue struct {
+    Kind            IssueKind       `json:"kind"`
+    Index           int             `json:"index"`
+    Time            time.Time       `json:"time"`
+    Detail          string          `json:"detail"`
+}
+
+// GapInfo describes a stretch of missing records between two consecutive
+// ones.
+type GapInfo struct {
+    After           time.Time       `json:"after"`
+    Before          time.Time       `json:"before"`
+    Missing         int             `json:"missing"`
+}
+
+// Report is the outcome of Check, meant to be logged or alerted on as is.
+type Report struct {
+    Records         int                 `json:"records"`
+    Interval        time.Duration       `json:"interval"`
+    Issues          []Issue             `json:"issues"`
+    Gaps            []GapInfo           `json:"gaps"`
+    Counts          map[IssueKind]int   `json:"counts"`
+}
+
+// OK tells whether no issue was found.
+func (r *Report) OK() bool {
+    return len(r.Issues) == 0
+}
+
+// Options tunes Check and Repair.
+type Options struct {
+    // Interval is the expected time between records. If zero, it is
+    // inferred from the series.
+    Interval        time.Duration
+    // OutlierMADs flags averages further than that many median absolute
+    // deviations from the median of the surrounding records. Zero disables
+    // outlier detection.
+    OutlierMADs     float64
+    // OutlierWindow is how many records on each side make up the
+    // surroundings. Defaults to 30.
+    OutlierWindow   int
+}
+
+// DefaultOptions flag outliers beyond 10 MADs, a deliberately loose setting:
+// bitcoin is volatile enough as it is.
+var DefaultOptions = Options{OutlierMADs: 10, OutlierWindow: 30}
+
+func (r *Report) add(kind IssueKind, idx int, t time.Time, detail string) {
+    r.Issues = append(r.Issues, Issue{Kind: kind, Index: idx, Time: t, Detail: detail})
+    r.Counts[kind]++
+}
+
+// Check inspects rs, which is expected to be in chronological order.
+func Check(rs []bapi.HistoryRecord, opts Options) *Report {
+    r := &Report{Records: len(rs), Interval: opts.Interval, Counts: make(map[IssueKind]int)}
+    if r.Interval <= 0 { r.Interval = inferInterval(rs) }
+
+    var last time.Time
+    for i, rec := range rs {
+        t := rec.DateTime
+
+        switch rec.Average.Sign() {
+        case 0: r.add(ZeroPrice, i, t, "average is zero or blank")
+        case -1: r.add(NegativePrice, i, t, fmt.Sprintf("average is %v", rec.Average))
+        }
+
+        if i == 0 {
+            last = t
+            continue
+        }
+
+        switch {
+        case t.Equal(last):
+            r.add(Duplicate, i, t, "repeats the previous timestamp")
+        case t.Before(last):
+            r.add(OutOfOrder, i, t, fmt.Sprintf("comes after %v", last.Format(time.RFC3339)))
+        default:
+            if missing := missingBetween(last, t, r.Interval); missing > 0 {
+                r.Gaps = append(r.Gaps, GapInfo{After: last, Before: t, Missing: missing})
+                r.add(Gap, i, t, fmt.Sprintf("%v records missing since %v", missing, last.Format(time.RFC3339)))
+            }
+            last = t
+        }
+    }
+
+    for _, i := range outliers(rs, opts) {
+        r.add(Outlier, i, rs[i].DateTime, fmt.Sprintf("average %v is out of line with its neighbours", rs[i].Average))
+    }
+
+    return r
+}
+
+func missingBetween(a, b time.Time, interval time.Duration) int {
+    if interval <= 0 { return 0 }
+    d := b.Sub(a)
+    if d < interval * 3 / 2 { return 0 }
+    return int((d + interval / 2) / interval) - 1
+}
+
+// inferInterval takes the median spacing between records.
+func inferInterval(rs []bapi.HistoryRecord) time.Duration {
+    var ds []time.Duration
+    for i := 1; i < len(rs); i++ {
+        if d := rs[i].DateTime.Sub(rs[i-1].DateTime); d > 0 {
+            ds = append(ds, d)
+        }
+    }
+    if len(ds) == 0 { return 0 }
+    sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+    return ds[len(ds) / 2]
+}
+
+// outliers returns the indexes of positive averages too far from the median
+// of their neighbours, in MADs as worked out by bapi.MedianMAD.
+func outliers(rs []bapi.HistoryRecord, opts Options) []int {
+    if opts.OutlierMADs <= 0 { return nil }
+    w := opts.OutlierWindow
+    if w <= 0 { w = 30 }
+
+    var idx []int
+    for i, rec := range rs {
+        if rec.Average.Sign() <= 0 { continue }
+
+        var xs []bapi.Decimal
+        for j := i - w; j <= i + w; j++ {
+            if j < 0 || j >= len(rs) || j == i || rs[j].Average.Sign() <= 0 { continue }
+            xs = append(xs, rs[j].Average)
+        }
+        if len(xs) < 3 { continue }
+
+        med, mad := bapi.MedianMAD(xs, nil)
+        if bapi.BeyondMADs(rec.Average, med, mad, opts.OutlierMADs) {
+            idx = append(idx, i)
+        }
+    }
+    return idx
+}
+
+// Scale is the number of decimal places interpolated prices are worked out
+// to, whatever the scale of the prices around them.
+const Scale = 8
+
+// RepairMode decides what Repair does about bad records.
+type RepairMode int
+
+const (
+    // Drop sorts the series, removes duplicates and records with bad
+    // prices, and leaves gaps alone.
+    Drop RepairMode = iota
+    // Interpolate does what Drop does, then fills every gap, including the
+    // ones left by dropped records, by linear interpolation. Interpolated
+    // records have High and Low equal to Average, rounded to Scale places,
+    // and no Volume.
+    Interpolate
+)
+
+// Repair returns a cleaned up copy of rs along with the report for the
+// original series.
+func Repair(rs []bapi.HistoryRecord, opts Options, mode RepairMode) ([]bapi.HistoryRecord, *Report) {
+    report := Check(rs, opts)
+
+    bad := make(map[int]bool)
+    for _, is := range report.Issues {
+        switch is.Kind {
+        case ZeroPrice, NegativePrice, Outlier: bad[is.Index] = true
+        }
+    }
+
+    type indexed struct {
+        i   int
+        r   bapi.HistoryRecord
+    }
+    var sorted []indexed
+    for i, rec := range rs {
+        sorted = append(sorted, indexed{i, rec})
+    }
+    sort.SliceStable(sorted, func(a, b int) bool { return sorted[a].r.DateTime.Before(sorted[b].r.DateTime) })
+
+    var out []bapi.HistoryRecord
+    for _, s := range sorted {
+        if bad[s.i] { continue }
+        if n := len(out); n > 0 && out[n-1].DateTime.Equal(s.r.DateTime) { continue }
+        out = append(out, s.r)
+    }
+
+    if mode != Interpolate || report.Interval <= 0 {
+        return out, report
+    }
+
+    var filled []bapi.HistoryRecord
+    for i, rec := range out {
+        if i > 0 {
+            filled = append(filled, interpolate(out[i-1], rec, report.Interval)...)
+        }
+        filled = append(filled, rec)
+    }
+    return filled, report
+}
+
+func interpolate(a, b bapi.HistoryRecord, interval time.Duration) []bapi.HistoryRecord {
+    missing := missingBetween(a.DateTime, b.DateTime, interval)
+    if missing == 0 { return nil }
+
+    steps := bapi.NewDecimal(int64(missing + 1), 0)
+    delta := b.Average.Sub(a.Average)
+
+    rs := make([]bapi.HistoryRecord, missing)
+    for k := 1; k <= missing; k++ {
+        // (a * steps + delta * k) / steps, so the only rounding is the
+        // final one to Scale.
+        num := a.Average.Mul(steps).Add(delta.Mul(bapi.NewDecimal(int64(k), 0)))
+        avg := num.Quo(steps, Scale, bapi.RoundHalfEven)
+        rs[k-1] = bapi.HistoryRecord{
+            DateTime: a.DateTime.Add(time.Duration(k) * interval),
+            High:     avg,
+            Low:      avg,
+            Average:  avg,
+        }
+    }
+    return rs
+}
@@ -0,0 +1,76 @@
+package quality
+
+import (
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+func rec(m int, avg string) bapi.HistoryRecord {
+    return bapi.HistoryRecord{
+        DateTime: time.Date(2014, 11, 4, 14, m, 0, 0, time.UTC),
+        Average:  bapi.MustParseDecimal(avg),
+    }
+}
+
+func TestCheck(t *testing.T) {
+    rs := []bapi.HistoryRecord{
+        rec(0, "330"), rec(1, "331"), rec(2, "330.5"), rec(2, "330.5"),
+        rec(5, "0"), rec(4, "331"), rec(6, "-1"), rec(7, "3300"),
+        rec(8, "331.2"), rec(9, "331.1"), rec(10, "330.9"),
+    }
+
+    r := Check(rs, DefaultOptions)
+    if r.Interval != time.Minute {
+        t.Errorf("inferred interval %v, want 1m", r.Interval)
+    }
+
+    want := map[IssueKind]int{Duplicate: 1, Gap: 1, ZeroPrice: 1, OutOfOrder: 1, NegativePrice: 1, Outlier: 1}
+    for k, n := range want {
+        if r.Counts[k] != n {
+            t.Errorf("%v: got %v issues, want %v", k, r.Counts[k], n)
+        }
+    }
+    if len(r.Gaps) != 1 || r.Gaps[0].Missing != 2 {
+        t.Errorf("unexpected gaps: %+v", r.Gaps)
+    }
+    for _, is := range r.Issues {
+        if is.Kind == Outlier && is.Index != 7 {
+            t.Errorf("flagged record %v as an outlier", is.Index)
+        }
+    }
+    if r.OK() {
+        t.Error("OK() on a broken series")
+    }
+}
+
+func TestRepair(t *testing.T) {
+    rs := []bapi.HistoryRecord{rec(0, "330"), rec(1, "0"), rec(3, "333"), rec(2, "332"), rec(2, "332"), rec(6, "336")}
+
+    out, _ := Repair(rs, Options{Interval: time.Minute}, Drop)
+    if len(out) != 4 {
+        t.Fatalf("Drop: got %v records, want 4", len(out))
+    }
+
+    out, _ = Repair(rs, Options{Interval: time.Minute}, Interpolate)
+    if len(out) != 7 {
+        t.Fatalf("Interpolate: got %v records, want 7", len(out))
+    }
+    for i, want := range []string{"330", "331", "332", "333", "334", "335", "336"} {
+        if !out[i].Average.Equal(bapi.MustParseDecimal(want)) || out[i].DateTime.Minute() != i {
+            t.Errorf("record %v: got %v at %v, want %v", i, out[i].Average, out[i].DateTime, want)
+        }
+    }
+    if r := Check(out, Options{Interval: time.Minute}); !r.OK() {
+        t.Errorf("repaired series still has issues: %+v", r.Issues)
+    }
+
+    // Coarse prices don't truncate what's interpolated between them.
+    out, _ = Repair([]bapi.HistoryRecord{rec(0, "100"), rec(3, "101")}, Options{Interval: time.Minute}, Interpolate)
+    for i, want := range []string{"100", "100.33333333", "100.66666667", "101"} {
+        if !out[i].Average.Equal(bapi.MustParseDecimal(want)) {
+            t.Errorf("record %v: got %v, want %v", i, out[i].Average, want)
+        }
+    }
+}
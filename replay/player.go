@@ -0,0 +1,388 @@
+package replay
+
+import (
+    "bufio"
+    "compress/gzip"
+    "context"
+    "encoding/json"
+    "net/http"
+    "errors"
+    "sort"
+    "sync"
+    "time"
+    "io"
+    "os"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+var (
+    // ErrExhausted is returned in sequential mode once every snapshot of a
+    // kind has been served.
+    ErrExhausted = errors.New("no more snapshots.")
+    // ErrNotRecorded is returned by the methods whose data is not part of
+    // recordings, by point-in-time lookups before the first snapshot, and by
+    // lookups into bulk snapshots the recording has none of.
+    ErrNotRecorded = errors.New("not recorded.")
+)
+
+// Player serves recorded snapshots through the bapi.ApiClient method set.
+//
+// In sequential mode, the default, every GlobalTickers, MarketTickers and
+// AllExchanges call consumes the next snapshot of its kind, and every
+// GlobalTicker and MarketTicker call the next one recorded for its symbol.
+// After SetTime, calls instead get the latest snapshot taken at or before
+// that time, as often as they like.
+//
+// The other methods look things up in the current bulk snapshot, without
+// consuming it: the one last consumed, or the next one if none has been yet.
+// That includes GlobalTicker and MarketTicker for symbols the recording has
+// no snapshots of their own for, which then come without Average24h.
+type Player struct {
+    mu              sync.Mutex
+    snaps           map[stream][]Snapshot
+    next            map[stream]int
+    at              time.Time
+}
+
+// stream identifies the snapshots of a kind, and for the per-symbol kinds,
+// of a symbol.
+type stream struct {
+    kind            Kind
+    symbol          string
+}
+
+var _ bapi.Client = (*Player)(nil)
+
+// Load reads a recording made by a Recorder.
+func Load(r io.Reader) (*Player, error) {
+    zr, err := gzip.NewReader(r)
+    if err != nil { return nil, err }
+    defer zr.Close()
+
+    p := &Player{snaps: make(map[stream][]Snapshot), next: make(map[stream]int)}
+    dec := json.NewDecoder(bufio.NewReader(zr))
+    for {
+        var s Snapshot
+        err = dec.Decode(&s)
+        if err == io.EOF { break }
+        if err != nil { return nil, err }
+        st := stream{s.Kind, s.Symbol}
+        p.snaps[st] = append(p.snaps[st], s)
+    }
+
+    for _, ss := range p.snaps {
+        sort.SliceStable(ss, func(i, j int) bool { return ss[i].Time.Before(ss[j].Time) })
+    }
+    return p, nil
+}
+
+// Open loads the recording in the named file.
+func Open(name string) (*Player, error) {
+    f, err := os.Open(name)
+    if err != nil { return nil, err }
+    defer f.Close()
+    return Load(f)
+}
+
+// SetTime switches to point-in-time mode at t. The zero time switches back
+// to sequential mode.
+func (p *Player) SetTime(t time.Time) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.at = t
+}
+
+// Rewind starts sequential playback over from the first snapshots.
+func (p *Player) Rewind() {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.next = make(map[stream]int)
+}
+
+// Snapshots returns how many snapshots of kind the recording holds, for all
+// symbols together.
+func (p *Player) Snapshots(kind Kind) int {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    n := 0
+    for st, ss := range p.snaps {
+        if st.kind == kind { n += len(ss) }
+    }
+    return n
+}
+
+func (p *Player) recorded(st stream) bool {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    return len(p.snaps[st]) > 0
+}
+
+// take decodes the snapshot of st due for the current mode into v,
+// consuming it in sequential mode.
+func (p *Player) take(ctx context.Context, st stream, v interface{}) error {
+    return p.snapshot(ctx, st, true, v)
+}
+
+// peek is like take, but never consumes anything.
+func (p *Player) peek(ctx context.Context, st stream, v interface{}) error {
+    return p.snapshot(ctx, st, false, v)
+}
+
+func (p *Player) snapshot(ctx context.Context, st stream, consume bool, v interface{}) error {
+    if err := ctx.Err(); err != nil { return err }
+
+    p.mu.Lock()
+    ss := p.snaps[st]
+    var s *Snapshot
+    if p.at.IsZero() {
+        i := p.next[st]
+        if !consume && i > 0 { i-- }
+        if i < len(ss) {
+            s = &ss[i]
+            if consume { p.next[st] = i + 1 }
+        }
+    } else {
+        i := sort.Search(len(ss), func(i int) bool { return ss[i].Time.After(p.at) })
+        if i > 0 { s = &ss[i-1] }
+    }
+    sequential := p.at.IsZero()
+    p.mu.Unlock()
+
+    if s == nil {
+        if sequential && consume { return ErrExhausted }
+        return ErrNotRecorded
+    }
+    return json.Unmarshal(s.Data, v)
+}
+
+func unknown(endpoint string) error {
+    return &bapi.APIError{StatusCode: http.StatusNotFound, Endpoint: endpoint, Message: "Unknown symbol."}
+}
+
+func keys(m map[string]bapi.Ticker) []string {
+    ks := make([]string, 0, len(m))
+    for k := range m {
+        ks = append(ks, k)
+    }
+    return ks
+}
+
+func (p *Player) GlobalTickerList() ([]string, error) {
+    return p.GlobalTickerListContext(context.Background())
+}
+
+func (p *Player) GlobalTickerListContext(ctx context.Context) ([]string, error) {
+    var at bapi.AllTickers
+    err := p.peek(ctx, stream{kind: GlobalTickers}, &at)
+    if err != nil { return nil, err }
+    return keys(at.Tickers), nil
+}
+
+func (p *Player) MarketTickerList() ([]string, error) {
+    return p.MarketTickerListContext(context.Background())
+}
+
+func (p *Player) MarketTickerListContext(ctx context.Context) ([]string, error) {
+    var at bapi.AllTickers
+    err := p.peek(ctx, stream{kind: MarketTickers}, &at)
+    if err != nil { return nil, err }
+    return keys(at.Tickers), nil
+}
+
+func (p *Player) ExchangeList() ([]string, error) {
+    return p.ExchangeListContext(context.Background())
+}
+
+func (p *Player) ExchangeListContext(ctx context.Context) ([]string, error) {
+    var ae bapi.AllExchanges
+    err := p.peek(ctx, stream{kind: AllExchanges}, &ae)
+    if err != nil { return nil, err }
+
+    ks := make([]string, 0, len(ae.Exchanges))
+    for k := range ae.Exchanges {
+        ks = append(ks, k)
+    }
+    return ks, nil
+}
+
+func (p *Player) HistoryList() ([]string, error) {
+    return p.HistoryListContext(context.Background())
+}
+
+func (p *Player) HistoryListContext(ctx context.Context) ([]string, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) GlobalTicker(symbol string) (*bapi.Ticker, error) {
+    return p.GlobalTickerContext(context.Background(), symbol)
+}
+
+func (p *Player) GlobalTickerContext(ctx context.Context, symbol string) (*bapi.Ticker, error) {
+    return p.ticker(ctx, GlobalTicker, GlobalTickers, symbol, "ticker/global/" + symbol)
+}
+
+func (p *Player) MarketTicker(symbol string) (*bapi.Ticker, error) {
+    return p.MarketTickerContext(context.Background(), symbol)
+}
+
+func (p *Player) MarketTickerContext(ctx context.Context, symbol string) (*bapi.Ticker, error) {
+    return p.ticker(ctx, MarketTicker, MarketTickers, symbol, "ticker/" + symbol)
+}
+
+// ticker serves the snapshots of kind recorded for symbol, if any, and
+// otherwise looks symbol up in the current snapshot of bulk.
+func (p *Player) ticker(ctx context.Context, kind, bulk Kind, symbol, endpoint string) (*bapi.Ticker, error) {
+    if st := (stream{kind, symbol}); p.recorded(st) {
+        var t bapi.Ticker
+        err := p.take(ctx, st, &t)
+        if err != nil { return nil, err }
+        return &t, nil
+    }
+
+    var at bapi.AllTickers
+    err := p.peek(ctx, stream{kind: bulk}, &at)
+    if err != nil { return nil, err }
+
+    t, ok := at.Tickers[symbol]
+    if !ok { return nil, unknown(endpoint) }
+    return &t, nil
+}
+
+func (p *Player) GlobalTickers() (*bapi.AllTickers, error) {
+    return p.GlobalTickersContext(context.Background())
+}
+
+func (p *Player) GlobalTickersContext(ctx context.Context) (*bapi.AllTickers, error) {
+    var at bapi.AllTickers
+    err := p.take(ctx, stream{kind: GlobalTickers}, &at)
+    if err != nil { return nil, err }
+    return &at, nil
+}
+
+func (p *Player) MarketTickers() (*bapi.AllTickers, error) {
+    return p.MarketTickersContext(context.Background())
+}
+
+func (p *Player) MarketTickersContext(ctx context.Context) (*bapi.AllTickers, error) {
+    var at bapi.AllTickers
+    err := p.take(ctx, stream{kind: MarketTickers}, &at)
+    if err != nil { return nil, err }
+    return &at, nil
+}
+
+func (p *Player) Exchanges(symbol string) (*bapi.ExchangeList, error) {
+    return p.ExchangesContext(context.Background(), symbol)
+}
+
+func (p *Player) ExchangesContext(ctx context.Context, symbol string) (*bapi.ExchangeList, error) {
+    var ae bapi.AllExchanges
+    err := p.peek(ctx, stream{kind: AllExchanges}, &ae)
+    if err != nil { return nil, err }
+
+    el, ok := ae.Exchanges[symbol]
+    if !ok { return nil, unknown("exchanges/" + symbol) }
+    return &bapi.ExchangeList{Exchanges: el, Timestamp: ae.Timestamp}, nil
+}
+
+func (p *Player) AllExchanges() (*bapi.AllExchanges, error) {
+    return p.AllExchangesContext(context.Background())
+}
+
+func (p *Player) AllExchangesContext(ctx context.Context) (*bapi.AllExchanges, error) {
+    var ae bapi.AllExchanges
+    err := p.take(ctx, stream{kind: AllExchanges}, &ae)
+    if err != nil { return nil, err }
+    return &ae, nil
+}
+
+// History isn't recorded: the history methods all return ErrNotRecorded.
+
+func (p *Player) MinutelyHistory(symbol string) ([]bapi.MinutelyHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) MinutelyHistoryContext(ctx context.Context, symbol string) ([]bapi.MinutelyHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) MinutelyHistoryEach(ctx context.Context, symbol string, fn func(bapi.MinutelyHistoryRecord) error) error {
+    return ErrNotRecorded
+}
+
+func (p *Player) MinutelyHistoryRange(symbol string, tr bapi.TimeRange) ([]bapi.MinutelyHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) MinutelyHistoryRangeContext(ctx context.Context, symbol string, tr bapi.TimeRange) ([]bapi.MinutelyHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) HourlyHistory(symbol string) ([]bapi.HourlyHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) HourlyHistoryContext(ctx context.Context, symbol string) ([]bapi.HourlyHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) HourlyHistoryEach(ctx context.Context, symbol string, fn func(bapi.HourlyHistoryRecord) error) error {
+    return ErrNotRecorded
+}
+
+func (p *Player) HourlyHistoryRange(symbol string, tr bapi.TimeRange) ([]bapi.HourlyHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) HourlyHistoryRangeContext(ctx context.Context, symbol string, tr bapi.TimeRange) ([]bapi.HourlyHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) DailyHistory(symbol string) ([]bapi.DailyHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) DailyHistoryContext(ctx context.Context, symbol string) ([]bapi.DailyHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) DailyHistoryEach(ctx context.Context, symbol string, fn func(bapi.DailyHistoryRecord) error) error {
+    return ErrNotRecorded
+}
+
+func (p *Player) DailyHistoryRange(symbol string, tr bapi.TimeRange) ([]bapi.DailyHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) DailyHistoryRangeContext(ctx context.Context, symbol string, tr bapi.TimeRange) ([]bapi.DailyHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) VolumeHistory(symbol string) ([]bapi.VolumeHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) VolumeHistoryContext(ctx context.Context, symbol string) ([]bapi.VolumeHistoryRecord, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) VolumeHistoryEach(ctx context.Context, symbol string, fn func(bapi.VolumeHistoryRecord) error) error {
+    return ErrNotRecorded
+}
+
+func (p *Player) History(symbol string, res bapi.Resolution, tr bapi.TimeRange) ([]bapi.HistoryRecord, bapi.Resolution, error) {
+    return nil, res, ErrNotRecorded
+}
+
+func (p *Player) HistoryContext(ctx context.Context, symbol string, res bapi.Resolution, tr bapi.TimeRange) ([]bapi.HistoryRecord, bapi.Resolution, error) {
+    return nil, res, ErrNotRecorded
+}
+
+func (p *Player) Ignored() (map[string]string, error) {
+    return nil, ErrNotRecorded
+}
+
+func (p *Player) IgnoredContext(ctx context.Context) (map[string]string, error) {
+    return nil, ErrNotRecorded
+}
@@ -0,0 +1,149 @@
+// Package replay records the ticker and exchange snapshots a bapi client
+// sees over time, and plays them back later through the same method set,
+// for backtests and bug reproduction.
+//
+// Recordings are gzipped streams of JSON lines, one Snapshot per line.
+package replay
+
+import (
+    "compress/gzip"
+    "context"
+    "encoding/json"
+    "sync"
+    "time"
+    "io"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+// Kind says which method produced a snapshot.
+type Kind string
+
+const (
+    GlobalTickers   Kind = "global_tickers"
+    MarketTickers   Kind = "market_tickers"
+    AllExchanges    Kind = "all_exchanges"
+    // GlobalTicker and MarketTicker snapshots hold a single symbol's ticker,
+    // which unlike those in the bulk snapshots carries the 24h average.
+    GlobalTicker    Kind = "global_ticker"
+    MarketTicker    Kind = "market_ticker"
+)
+
+// Snapshot is a single recorded response.
+type Snapshot struct {
+    Kind            Kind            `json:"kind"`
+    // Symbol is only set for the per-symbol kinds.
+    Symbol          string          `json:"symbol,omitempty"`
+    // Time is when the snapshot was taken, not the API's own timestamp.
+    Time            time.Time       `json:"time"`
+    Data            json.RawMessage `json:"data"`
+}
+
+// Recorder is a bapi.Client that passes calls through to another one,
+// recording every successful GlobalTickers, MarketTickers, AllExchanges,
+// GlobalTicker and MarketTicker response along the way.
+type Recorder struct {
+    bapi.Client
+
+    mu              sync.Mutex
+    zw              *gzip.Writer
+    enc             *json.Encoder
+    err             error
+}
+
+var _ bapi.Client = (*Recorder)(nil)
+
+// NewRecorder records the responses of c to w. Close the Recorder to flush
+// the recording; w itself is left open.
+func NewRecorder(c bapi.Client, w io.Writer) *Recorder {
+    zw := gzip.NewWriter(w)
+    return &Recorder{Client: c, zw: zw, enc: json.NewEncoder(zw)}
+}
+
+// Close flushes the recording. It returns the first write error, if any.
+func (r *Recorder) Close() error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    err := r.zw.Close()
+    if r.err == nil { r.err = err }
+    return r.err
+}
+
+// Err returns the first error met while writing the recording. Write errors
+// don't fail the calls being recorded.
+func (r *Recorder) Err() error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.err
+}
+
+func (r *Recorder) record(kind Kind, symbol string, v interface{}) {
+    data, err := json.Marshal(v)
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.err != nil { return }
+    if err == nil {
+        err = r.enc.Encode(Snapshot{Kind: kind, Symbol: symbol, Time: time.Now().UTC(), Data: data})
+    }
+    if err == nil {
+        err = r.zw.Flush()
+    }
+    r.err = err
+}
+
+func (r *Recorder) GlobalTicker(symbol string) (*bapi.Ticker, error) {
+    return r.GlobalTickerContext(context.Background(), symbol)
+}
+
+func (r *Recorder) GlobalTickerContext(ctx context.Context, symbol string) (*bapi.Ticker, error) {
+    t, err := r.Client.GlobalTickerContext(ctx, symbol)
+    if err != nil { return nil, err }
+    r.record(GlobalTicker, symbol, t)
+    return t, nil
+}
+
+func (r *Recorder) MarketTicker(symbol string) (*bapi.Ticker, error) {
+    return r.MarketTickerContext(context.Background(), symbol)
+}
+
+func (r *Recorder) MarketTickerContext(ctx context.Context, symbol string) (*bapi.Ticker, error) {
+    t, err := r.Client.MarketTickerContext(ctx, symbol)
+    if err != nil { return nil, err }
+    r.record(MarketTicker, symbol, t)
+    return t, nil
+}
+
+func (r *Recorder) GlobalTickers() (*bapi.AllTickers, error) {
+    return r.GlobalTickersContext(context.Background())
+}
+
+func (r *Recorder) GlobalTickersContext(ctx context.Context) (*bapi.AllTickers, error) {
+    at, err := r.Client.GlobalTickersContext(ctx)
+    if err != nil { return nil, err }
+    r.record(GlobalTickers, "", at)
+    return at, nil
+}
+
+func (r *Recorder) MarketTickers() (*bapi.AllTickers, error) {
+    return r.MarketTickersContext(context.Background())
+}
+
+func (r *Recorder) MarketTickersContext(ctx context.Context) (*bapi.AllTickers, error) {
+    at, err := r.Client.MarketTickersContext(ctx)
+    if err != nil { return nil, err }
+    r.record(MarketTickers, "", at)
+    return at, nil
+}
+
+func (r *Recorder) AllExchanges() (*bapi.AllExchanges, error) {
+    return r.AllExchangesContext(context.Background())
+}
+
+func (r *Recorder) AllExchangesContext(ctx context.Context) (*bapi.AllExchanges, error) {
+    ae, err := r.Client.AllExchangesContext(ctx)
+    if err != nil { return nil, err }
+    r.record(AllExchanges, "", ae)
+    return ae, nil
+}
@@ -0,0 +1,93 @@
+package replay
+
+import (
+    "bytes"
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+    "github.com/mvillalba/go-bitcoinaverage/bapitest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+    srv := bapitest.NewServer()
+    defer srv.Close()
+
+    var buf bytes.Buffer
+    rec := NewRecorder(bapi.NewWithOptions(srv.URL), &buf)
+
+    if _, err := rec.GlobalTickers(); err != nil { t.Fatal(err) }
+    if _, err := rec.AllExchanges(); err != nil { t.Fatal(err) }
+    if _, err := rec.GlobalTicker("USD"); err != nil { t.Fatal(err) }
+    mid := time.Now()
+    time.Sleep(10 * time.Millisecond)
+    srv.SetFixture("ticker/global/all", []byte(`{"USD": {"last": 400, "timestamp": "Tue, 04 Nov 2014 14:23:03 -0000"}, "timestamp": "Tue, 04 Nov 2014 14:23:03 -0000"}`))
+    if _, err := rec.GlobalTickers(); err != nil { t.Fatal(err) }
+    if err := rec.Close(); err != nil { t.Fatal(err) }
+
+    p, err := Load(&buf)
+    if err != nil { t.Fatal(err) }
+    if p.Snapshots(GlobalTickers) != 2 || p.Snapshots(AllExchanges) != 1 || p.Snapshots(MarketTickers) != 0 || p.Snapshots(GlobalTicker) != 1 {
+        t.Fatalf("unexpected recording")
+    }
+
+    // Sequential mode. Lookups into the bulk snapshot don't consume it.
+    for i := 0; i < 2; i++ {
+        tk, err := p.GlobalTicker("EUR")
+        if err != nil || !tk.Last.Equal(bapi.MustParseDecimal("263.95")) {
+            t.Errorf("lookup %v: got %+v, %v", i, tk, err)
+        }
+    }
+    at, err := p.GlobalTickers()
+    if err != nil || !at.Tickers["USD"].Last.Equal(bapi.MustParseDecimal("329.97")) {
+        t.Errorf("first snapshot: got %+v, %v", at, err)
+    }
+    at, err = p.GlobalTickers()
+    if err != nil || !at.Tickers["USD"].Last.Equal(bapi.MustParseDecimal("400")) || at.Timestamp.Minute() != 23 {
+        t.Errorf("second snapshot: got %+v, %v", at, err)
+    }
+    if _, err = p.GlobalTickers(); err != ErrExhausted {
+        t.Errorf("got %v, want ErrExhausted", err)
+    }
+    if _, err = p.GlobalTicker("EUR"); !errors.Is(err, bapi.ErrUnknownSymbol) {
+        t.Errorf("got %v, want ErrUnknownSymbol from the last snapshot", err)
+    }
+
+    // Recorded per-symbol tickers are served as recorded, 24h average and
+    // all, and consumed like bulk snapshots.
+    tk, err := p.GlobalTicker("USD")
+    if err != nil || !tk.Last.Equal(bapi.MustParseDecimal("329.97")) || !tk.Average24h.Equal(bapi.MustParseDecimal("327.65")) {
+        t.Errorf("per-symbol snapshot: got %+v, %v", tk, err)
+    }
+    if _, err = p.GlobalTicker("USD"); err != ErrExhausted {
+        t.Errorf("got %v, want ErrExhausted", err)
+    }
+
+    el, err := p.Exchanges("EUR")
+    if err != nil || len(el.Exchanges) != 2 {
+        t.Errorf("got %+v, %v", el, err)
+    }
+    if _, err = p.MarketTickers(); err != ErrExhausted {
+        t.Errorf("got %v, want ErrExhausted", err)
+    }
+    if _, err = p.MarketTicker("USD"); err != ErrNotRecorded {
+        t.Errorf("got %v, want ErrNotRecorded", err)
+    }
+
+    // Point in time.
+    p.SetTime(mid)
+    for i := 0; i < 2; i++ {
+        tk, err = p.GlobalTicker("USD")
+        if err != nil || !tk.Last.Equal(bapi.MustParseDecimal("329.97")) || tk.Average24h.Sign() <= 0 {
+            t.Errorf("at %v: got %+v, %v", mid, tk, err)
+        }
+    }
+    if _, err = p.GlobalTicker("XYZ"); !errors.Is(err, bapi.ErrUnknownSymbol) {
+        t.Errorf("got %v, want ErrUnknownSymbol", err)
+    }
+    p.SetTime(mid.Add(-time.Hour))
+    if _, err = p.GlobalTickers(); err != ErrNotRecorded {
+        t.Errorf("got %v, want ErrNotRecorded", err)
+    }
+}
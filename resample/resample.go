@@ -0,0 +1,187 @@
+// Package resample turns bapi history series into OHLC bars of arbitrary
+// width: 5-minute bars out of minutely records, 4-hour bars out of hourly
+// ones, weekly bars out of daily ones and so on.
+package resample
+
+import (
+    "errors"
+    "sort"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+// EmptyPolicy decides what happens to buckets no record falls into.
+type EmptyPolicy int
+
+const (
+    // SkipEmpty leaves empty buckets out of the result.
+    SkipEmpty EmptyPolicy = iota
+    // FillPrevious emits a flat bar at the previous bar's close.
+    FillPrevious
+    // KeepEmpty emits a zero-valued bar.
+    KeepEmpty
+)
+
+// Scale is the number of decimal places bar averages are rounded to.
+const Scale = 8
+
+// Options controls how records are bucketed.
+type Options struct {
+    // Interval is the width of each bar.
+    Interval        time.Duration
+    // Location is the time zone buckets are aligned in. Nil means UTC.
+    Location        *time.Location
+    // Buckets are laid end to end from Origin, Monday midnight in Location
+    // if zero. A bucket starts at every local midnight only if Interval
+    // divides 24 hours evenly; 7-hour bars, say, drift across days. Only
+    // Origin's wall clock in Location matters.
+    Origin          time.Time
+    Empty           EmptyPolicy
+}
+
+// Bar is a resampled OHLC bar covering [Start, End).
+type Bar struct {
+    Start           time.Time
+    End             time.Time
+    Open            bapi.Decimal
+    High            bapi.Decimal
+    Low             bapi.Decimal
+    Close           bapi.Decimal
+    Average         bapi.Decimal
+    // Volume is only meaningful if HasVolume, i.e. if the source records
+    // carried volume figures.
+    Volume          bapi.Decimal
+    HasVolume       bool
+    // Count is the number of records in the bar, zero for empty ones.
+    Count           int
+    Empty           bool
+}
+
+// The default origin, a Monday.
+var defaultOrigin = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+
+func FromMinutely(rs []bapi.MinutelyHistoryRecord) []bapi.HistoryRecord {
+    out := make([]bapi.HistoryRecord, len(rs))
+    for i, r := range rs {
+        out[i] = r.HistoryRecord()
+    }
+    return out
+}
+
+func FromHourly(rs []bapi.HourlyHistoryRecord) []bapi.HistoryRecord {
+    out := make([]bapi.HistoryRecord, len(rs))
+    for i, r := range rs {
+        out[i] = r.HistoryRecord()
+    }
+    return out
+}
+
+func FromDaily(rs []bapi.DailyHistoryRecord) []bapi.HistoryRecord {
+    out := make([]bapi.HistoryRecord, len(rs))
+    for i, r := range rs {
+        out[i] = r.HistoryRecord()
+    }
+    return out
+}
+
+// aligner maps instants to bucket indexes and back, working on wall clock
+// time in the target location so that buckets follow the local clock.
+type aligner struct {
+    interval        time.Duration
+    loc             *time.Location
+    origin          time.Time
+}
+
+func wall(t time.Time, loc *time.Location) time.Time {
+    lt := t.In(loc)
+    return time.Date(lt.Year(), lt.Month(), lt.Day(), lt.Hour(), lt.Minute(), lt.Second(), lt.Nanosecond(), time.UTC)
+}
+
+func (a *aligner) index(t time.Time) int64 {
+    d := wall(t, a.loc).Sub(a.origin)
+    idx := int64(d / a.interval)
+    if d % a.interval < 0 { idx-- }
+    return idx
+}
+
+func (a *aligner) start(idx int64) time.Time {
+    w := a.origin.Add(time.Duration(idx) * a.interval)
+    return time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), w.Nanosecond(), a.loc)
+}
+
+// Resample buckets records into bars. Records need not be sorted.
+func Resample(records []bapi.HistoryRecord, opts Options) ([]Bar, error) {
+    if opts.Interval <= 0 {
+        return nil, errors.New("resample interval must be positive.")
+    }
+
+    a := &aligner{interval: opts.Interval, loc: opts.Location, origin: defaultOrigin}
+    if a.loc == nil { a.loc = time.UTC }
+    if !opts.Origin.IsZero() { a.origin = wall(opts.Origin, a.loc) }
+
+    rs := append([]bapi.HistoryRecord(nil), records...)
+    sort.SliceStable(rs, func(i, j int) bool { return rs[i].DateTime.Before(rs[j].DateTime) })
+
+    var bars []Bar
+    var cur *Bar
+    var curIdx int64
+    var sum bapi.Decimal
+
+    flush := func() {
+        if cur == nil { return }
+        cur.Average = sum.Quo(bapi.NewDecimal(int64(cur.Count), 0), Scale, bapi.RoundHalfEven)
+        bars = append(bars, *cur)
+    }
+
+    for _, r := range rs {
+        idx := a.index(r.DateTime)
+        if cur != nil && idx == curIdx {
+            add(cur, r)
+            sum = sum.Add(r.Average)
+            continue
+        }
+
+        flush()
+        if cur != nil {
+            for i := curIdx + 1; i < idx && opts.Empty != SkipEmpty; i++ {
+                bars = append(bars, emptyBar(a, i, bars[len(bars)-1], opts.Empty))
+            }
+        }
+
+        curIdx = idx
+        cur = &Bar{Start: a.start(idx), End: a.start(idx + 1)}
+        add(cur, r)
+        sum = r.Average
+    }
+    flush()
+
+    return bars, nil
+}
+
+func add(b *Bar, r bapi.HistoryRecord) {
+    high, low := r.High, r.Low
+    if high.IsZero() { high = r.Average }
+    if low.IsZero() { low = r.Average }
+
+    if b.Count == 0 {
+        b.Open, b.High, b.Low = r.Average, high, low
+    } else {
+        if high.Cmp(b.High) > 0 { b.High = high }
+        if low.Cmp(b.Low) < 0 { b.Low = low }
+    }
+    b.Close = r.Average
+    if !r.Volume.IsZero() {
+        b.HasVolume = true
+    }
+    b.Volume = b.Volume.Add(r.Volume)
+    b.Count++
+}
+
+func emptyBar(a *aligner, idx int64, prev Bar, policy EmptyPolicy) Bar {
+    b := Bar{Start: a.start(idx), End: a.start(idx + 1), Empty: true, HasVolume: prev.HasVolume}
+    if policy == FillPrevious {
+        b.Open, b.High, b.Low, b.Close, b.Average = prev.Close, prev.Close, prev.Close, prev.Close, prev.Close
+    }
+    return b
+}
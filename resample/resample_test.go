@@ -0,0 +1,86 @@
+package resample
+
+import (
+    "testing"
+    "time"
+
+    "github.com/mvillalba/go-bitcoinaverage/bapi"
+)
+
+func minute(m int, avg string) bapi.MinutelyHistoryRecord {
+    return bapi.MinutelyHistoryRecord{
+        DateTime: time.Date(2014, 11, 4, 14, m, 0, 0, time.UTC),
+        Average:  bapi.MustParseDecimal(avg),
+    }
+}
+
+func TestFiveMinuteBars(t *testing.T) {
+    rs := FromMinutely([]bapi.MinutelyHistoryRecord{
+        minute(3, "10"), minute(1, "12"), minute(4, "9"), minute(2, "11"),
+        minute(16, "20"),
+    })
+
+    bars, err := Resample(rs, Options{Interval: 5 * time.Minute})
+    if err != nil { t.Fatal(err) }
+    if len(bars) != 2 {
+        t.Fatalf("got %v bars, want 2", len(bars))
+    }
+
+    b := bars[0]
+    if !b.Start.Equal(time.Date(2014, 11, 4, 14, 0, 0, 0, time.UTC)) || b.End.Sub(b.Start) != 5 * time.Minute {
+        t.Errorf("bucket: %v - %v", b.Start, b.End)
+    }
+    for _, c := range []struct{ name string; got bapi.Decimal; want string }{
+        {"Open", b.Open, "12"}, {"High", b.High, "12"}, {"Low", b.Low, "9"},
+        {"Close", b.Close, "9"}, {"Average", b.Average, "10.5"},
+    } {
+        if !c.got.Equal(bapi.MustParseDecimal(c.want)) {
+            t.Errorf("%v: got %v, want %v", c.name, c.got, c.want)
+        }
+    }
+    if b.Count != 4 || b.HasVolume {
+        t.Errorf("Count %v, HasVolume %v", b.Count, b.HasVolume)
+    }
+}
+
+func TestEmptyBuckets(t *testing.T) {
+    rs := FromMinutely([]bapi.MinutelyHistoryRecord{minute(1, "12"), minute(16, "20")})
+
+    bars, _ := Resample(rs, Options{Interval: 5 * time.Minute, Empty: FillPrevious})
+    if len(bars) != 4 || !bars[1].Empty || !bars[2].Close.Equal(bapi.MustParseDecimal("12")) {
+        t.Errorf("FillPrevious: got %+v", bars)
+    }
+
+    bars, _ = Resample(rs, Options{Interval: 5 * time.Minute, Empty: KeepEmpty})
+    if len(bars) != 4 || !bars[2].Empty || !bars[2].Close.IsZero() || bars[2].Count != 0 {
+        t.Errorf("KeepEmpty: got %+v", bars)
+    }
+}
+
+func TestAlignment(t *testing.T) {
+    day := func(d int) bapi.DailyHistoryRecord {
+        return bapi.DailyHistoryRecord{
+            DateTime: time.Date(2014, 11, d, 0, 0, 0, 0, time.UTC),
+            Average:  bapi.MustParseDecimal("1"),
+            Volume:   bapi.MustParseDecimal("2"),
+        }
+    }
+
+    // 2014-11-03 was a Monday.
+    bars, _ := Resample(FromDaily([]bapi.DailyHistoryRecord{day(2), day(3), day(9), day(10)}),
+        Options{Interval: 7 * 24 * time.Hour})
+    if len(bars) != 3 || bars[1].Start.Weekday() != time.Monday || bars[1].Count != 2 {
+        t.Fatalf("weekly: got %+v", bars)
+    }
+    if !bars[1].HasVolume || !bars[1].Volume.Equal(bapi.MustParseDecimal("4")) {
+        t.Errorf("weekly volume: got %v", bars[1].Volume)
+    }
+
+    // Four hour bars in UTC+3 start at local midnight, 21:00 UTC.
+    loc := time.FixedZone("UTC+3", 3 * 3600)
+    rs := []bapi.HistoryRecord{{DateTime: time.Date(2014, 11, 4, 22, 0, 0, 0, time.UTC), Average: bapi.MustParseDecimal("1")}}
+    bars, _ = Resample(rs, Options{Interval: 4 * time.Hour, Location: loc})
+    if want := time.Date(2014, 11, 4, 21, 0, 0, 0, time.UTC); !bars[0].Start.Equal(want) {
+        t.Errorf("got start %v, want %v", bars[0].Start, want)
+    }
+}